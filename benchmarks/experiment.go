@@ -0,0 +1,523 @@
+//go:build goexperiment.regions
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	. "experiments/benchmarks/metrics"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// An experiment describes a whole sweep. It is read from the JSON file given
+// by -experiment, so experiment definitions can be committed next to their results:
+//
+//	{
+//		"Programs": ["mat-mul", "bin-tree"],
+//		"Managers": ["GC", "RBMM"],
+//		"Goroutines": [1, 16, 32, 64, 128, 256],
+//		"Rounds": 10,
+//		"Workload": {"BinOp": 2000, "GCPercent": -1},
+//		"Results": "results"
+//	}
+//
+// Fields missing from the file keep the defaults of the flags, and flags that
+// are given explicitly override the file.
+type experiment struct {
+	Programs   []string
+	Managers   []MemoryManager
+	Goroutines goroutineCounts
+	WarmUp     int
+	Rounds     int
+	Workload   workload
+	Results    string
+	Shuffle    bool
+	Seed       uint64
+	Isolate    string
+	Timeout    duration
+	Deadline   duration
+}
+
+// workload holds the sizes and GC settings of the workloads.
+type workload struct {
+	// Values of mat-mul and pro-con are drawn from [1, Range]
+	Range int
+	// Rows and columns of the matrices, 0 scales them with the amount of goroutines
+	MatrixSize int
+
+	BinOp int
+	// Percentages of inserts, searches and removes done on the tree
+	BinMix  OperationMix
+	BinKeys KeyDistribution
+
+	ProConOp int
+
+	ServHandOp int
+	// Bytes sent with every request and requests sent on every connection
+	ServHandPayload   int
+	ServHandKeepAlive int
+	// tcp, unix or pipe
+	ServHandNetwork string
+
+	HTTPOp int
+	// Values in the JSON body of every http request
+	HTTPValues int
+
+	// Records parsed per goroutine, stages of the pipeline and records per batch
+	PipelineOp     int
+	PipelineStages int
+	PipelineBatch  int
+
+	// Jobs per worker and ints in the scratch slice of every job
+	WorkerPoolJobs    int
+	WorkerPoolScratch int
+
+	LRUOp int
+	// Shards of the cache and entries per shard
+	LRUShards   int
+	LRUCapacity int
+	// Percentages of gets for cached keys and of misses that insert
+	LRUHitRatio  int
+	LRUEvictRate int
+	// Smallest and largest value in bytes
+	LRUValueMin int
+	LRUValueMax int
+
+	// Vertices of the graph and edges added by every vertex
+	GraphVertices int
+	GraphDegree   int
+	// uniform or power-law
+	GraphShape   string
+	GraphQueries int
+
+	// Documents processed per goroutine and items per document
+	JSONDocs  int
+	JSONItems int
+
+	StringOp int
+	// Most fields per log line and lines per log before it is flushed
+	StringFields int
+	StringFlush  int
+
+	// Object sizes of alloc-sweep, each one a program of its own, see allocSweepPrograms
+	AllocSweepSizes []int
+	// Objects allocated per run and the most bytes they may take
+	AllocSweepCount  int
+	AllocSweepBudget int
+
+	ChannelMessages int
+	// Buffers, payload sizes and senders x receivers of channel-matrix, every
+	// combination is a program of its own, see channelMatrixPrograms
+	ChannelBuffers  []int
+	ChannelPayloads []int
+	ChannelRatios   []string
+
+	LifecycleCycles int
+	// Initial sizes, objects and depths of region-lifecycle, every combination
+	// is a program of its own, see lifecyclePrograms
+	LifecycleSizes   []int
+	LifecycleObjects []int
+	LifecycleDepths  []int
+
+	NestedRequests int
+	// Sub-tasks per task, levels of sub-tasks below a request and objects per task
+	NestedFanout  int
+	NestedDepth   int
+	NestedObjects int
+
+	HashOp int
+	// Percentages of inserts, searches and removes done on the hash map
+	HashMix  OperationMix
+	HashKeys KeyDistribution
+	// Skew of zipfian keys, must be larger than 1
+	ZipfSkew float64
+	// Initial buckets of hash-map-resize and the values per bucket that make it grow
+	HashInitCap    int
+	HashLoadFactor int
+
+	GCPercent int
+	// Seed of the random number generators of the workloads
+	Seed uint64
+	// Check the results of the workloads, a wrong result fails the round
+	Verify bool
+}
+
+func defaultWorkload() workload {
+	return workload{
+		Range:             100,
+		BinOp:             BinOp,
+		BinMix:            BinMix,
+		BinKeys:           BinKeys,
+		ProConOp:          ProConOp,
+		ServHandOp:        ServHandOp,
+		ServHandPayload:   ServHandPayload,
+		ServHandKeepAlive: ServHandKeepAlive,
+		ServHandNetwork:   ServHandNetwork,
+		HTTPOp:            HTTPOp,
+		HTTPValues:        HTTPValues,
+		PipelineOp:        PipelineOp,
+		PipelineStages:    PipelineStages,
+		PipelineBatch:     PipelineBatch,
+		WorkerPoolJobs:    WorkerPoolJobs,
+		WorkerPoolScratch: WorkerPoolScratch,
+		LRUOp:             LRUOp,
+		LRUShards:         LRUShards,
+		LRUCapacity:       LRUCapacity,
+		LRUHitRatio:       LRUHitRatio,
+		LRUEvictRate:      LRUEvictRate,
+		LRUValueMin:       LRUValueMin,
+		LRUValueMax:       LRUValueMax,
+		GraphVertices:     GraphVertices,
+		GraphDegree:       GraphDegree,
+		GraphShape:        GraphShape,
+		GraphQueries:      GraphQueries,
+		JSONDocs:          JSONDocs,
+		JSONItems:         JSONItems,
+		StringOp:          StringOp,
+		StringFields:      StringFields,
+		StringFlush:       StringFlush,
+		AllocSweepSizes:   AllocSweepSizes,
+		AllocSweepCount:   AllocSweepCount,
+		AllocSweepBudget:  AllocSweepBudget,
+		ChannelMessages:   ChannelMessages,
+		ChannelBuffers:    ChannelBuffers,
+		ChannelPayloads:   ChannelPayloads,
+		ChannelRatios:     ChannelRatios,
+		LifecycleCycles:   LifecycleCycles,
+		LifecycleSizes:    LifecycleSizes,
+		LifecycleObjects:  LifecycleObjects,
+		LifecycleDepths:   LifecycleDepths,
+		NestedRequests:    NestedRequests,
+		NestedFanout:      NestedFanout,
+		NestedDepth:       NestedDepth,
+		NestedObjects:     NestedObjects,
+		HashOp:            HashOp,
+		HashMix:           HashMix,
+		HashKeys:          HashKeys,
+		ZipfSkew:          ZipfSkew,
+		HashInitCap:       HashInitCap,
+		HashLoadFactor:    HashLoadFactor,
+		MatrixSize:        MatrixSize,
+		GCPercent:         GCPercent,
+		Seed:              Seed,
+		Verify:            Verify,
+	}
+}
+
+// apply sets the configurations read by the workloads.
+func (w workload) apply() {
+	BinOp = w.BinOp
+	BinMix = w.BinMix
+	BinKeys = w.BinKeys
+	ProConOp = w.ProConOp
+	ServHandOp = w.ServHandOp
+	ServHandPayload = w.ServHandPayload
+	ServHandKeepAlive = w.ServHandKeepAlive
+	ServHandNetwork = w.ServHandNetwork
+	HTTPOp = w.HTTPOp
+	HTTPValues = w.HTTPValues
+	PipelineOp = w.PipelineOp
+	PipelineStages = w.PipelineStages
+	PipelineBatch = w.PipelineBatch
+	WorkerPoolJobs = w.WorkerPoolJobs
+	WorkerPoolScratch = w.WorkerPoolScratch
+	LRUOp = w.LRUOp
+	LRUShards = w.LRUShards
+	LRUCapacity = w.LRUCapacity
+	LRUHitRatio = w.LRUHitRatio
+	LRUEvictRate = w.LRUEvictRate
+	LRUValueMin = w.LRUValueMin
+	LRUValueMax = w.LRUValueMax
+	GraphVertices = w.GraphVertices
+	GraphDegree = w.GraphDegree
+	GraphShape = w.GraphShape
+	GraphQueries = w.GraphQueries
+	JSONDocs = w.JSONDocs
+	JSONItems = w.JSONItems
+	StringOp = w.StringOp
+	StringFields = w.StringFields
+	StringFlush = w.StringFlush
+	AllocSweepSizes = w.AllocSweepSizes
+	AllocSweepCount = w.AllocSweepCount
+	AllocSweepBudget = w.AllocSweepBudget
+	ChannelMessages = w.ChannelMessages
+	ChannelBuffers = w.ChannelBuffers
+	ChannelPayloads = w.ChannelPayloads
+	ChannelRatios = w.ChannelRatios
+	LifecycleCycles = w.LifecycleCycles
+	LifecycleSizes = w.LifecycleSizes
+	LifecycleObjects = w.LifecycleObjects
+	LifecycleDepths = w.LifecycleDepths
+	NestedRequests = w.NestedRequests
+	NestedFanout = w.NestedFanout
+	NestedDepth = w.NestedDepth
+	NestedObjects = w.NestedObjects
+	HashOp = w.HashOp
+	HashMix = w.HashMix
+	HashKeys = w.HashKeys
+	ZipfSkew = w.ZipfSkew
+	HashInitCap = w.HashInitCap
+	HashLoadFactor = w.HashLoadFactor
+	MatrixSize = w.MatrixSize
+	GCPercent = w.GCPercent
+	Seed = w.Seed
+	Verify = w.Verify
+}
+
+// goroutineCounts is either a list of goroutine counts or a geometric range
+// "start:end:factor", see parseGoroutines.
+type goroutineCounts []int
+
+func (g *goroutineCounts) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		gs, err := parseGoroutines(s)
+		*g = gs
+		return err
+	}
+	return json.Unmarshal(b, (*[]int)(g))
+}
+
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	*d = duration(v)
+	return err
+}
+
+// loadExperiment builds the experiment from the flags and the experiment file.
+func loadExperiment() (experiment, error) {
+	e := experiment{Workload: defaultWorkload()}
+	if err := applyFlags(&e, flag.VisitAll); err != nil {
+		return e, err
+	}
+
+	if *experimentFile != "" {
+		b, err := os.ReadFile(*experimentFile)
+		if err != nil {
+			return e, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			return e, fmt.Errorf("%s: %v", *experimentFile, err)
+		}
+		if err := applyFlags(&e, flag.Visit); err != nil {
+			return e, err
+		}
+	}
+
+	return e, e.validate()
+}
+
+// applyFlags overrides e with the flags visited by visit.
+func applyFlags(e *experiment, visit func(func(*flag.Flag))) error {
+	var err error
+	visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "programs":
+			e.Programs = strings.Split(*programs, ",")
+		case "managers":
+			e.Managers = nil
+			for _, s := range strings.Split(*managers, ",") {
+				mm, mmErr := parseMemoryManager(s)
+				if mmErr != nil {
+					err = mmErr
+				}
+				e.Managers = append(e.Managers, mm)
+			}
+		case "goroutines":
+			var gErr error
+			if e.Goroutines, gErr = parseGoroutines(*goroutines); gErr != nil {
+				err = gErr
+			}
+		case "warmup":
+			e.WarmUp = *warmUp
+		case "rounds":
+			e.Rounds = *rounds
+		case "results":
+			e.Results = *results
+		case "shuffle":
+			e.Shuffle = *shuffle
+		case "seed":
+			e.Seed = *seed
+		case "workload-seed":
+			e.Workload.Seed = *workloadSeed
+		case "isolate":
+			e.Isolate = *isolate
+		case "timeout":
+			e.Timeout = duration(*timeout)
+		case "deadline":
+			e.Deadline = duration(*deadline)
+		}
+	})
+	return err
+}
+
+func (e experiment) validate() error {
+	if len(e.Programs) == 0 || len(e.Managers) == 0 || len(e.Goroutines) == 0 {
+		return errors.New("experiment needs at least one program, memory manager and goroutine count")
+	}
+	for _, p := range e.Programs {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+			return errors.New("experiment has an empty program")
+		case strings.HasPrefix(p, "channel-matrix/"):
+			if _, _, _, _, ok := parseChannelMatrix(p); !ok {
+				return fmt.Errorf("channel-matrix program %q is not channel-matrix/buf<buffer>-pay<payload>-<senders>x<receivers> with a power of two payload from 8 to %d", p, 1<<15)
+			}
+		case strings.HasPrefix(p, "region-lifecycle/"):
+			if _, _, _, ok := parseLifecycle(p); !ok {
+				return fmt.Errorf("region-lifecycle program %q is not region-lifecycle/size<bytes>-obj<objects>-depth<depth> with a positive depth", p)
+			}
+		case strings.HasPrefix(p, "alloc-sweep/"):
+			if size, _, ok := parseAllocSweep(p); !ok || !validSweepSize(size) {
+				return fmt.Errorf("alloc-sweep program %q is not alloc-sweep/<size>-bytes or alloc-sweep/<size>-pointers with a power of two size from 8 to %d", p, 1<<24)
+			}
+		case !slices.Contains(programNames, p):
+			return fmt.Errorf("unknown program %q, expected one of %s", p, strings.Join(programNames, ", "))
+		}
+	}
+	for _, g := range e.Goroutines {
+		if g < 1 {
+			return fmt.Errorf("goroutine count %d must be positive", g)
+		}
+	}
+	if e.Rounds < 1 || e.WarmUp < 0 {
+		return fmt.Errorf("experiment needs at least one round and no negative warm-up, got %d and %d", e.Rounds, e.WarmUp)
+	}
+	if !e.Workload.BinMix.Valid() {
+		return fmt.Errorf("bin-tree operation mix %+v needs non-negative percentages with a positive sum", e.Workload.BinMix)
+	}
+	if e.Workload.ZipfSkew <= 1 {
+		return fmt.Errorf("zipf skew %v must be larger than 1", e.Workload.ZipfSkew)
+	}
+	if !e.Workload.HashMix.Valid() {
+		return fmt.Errorf("hash-map operation mix %+v needs non-negative percentages with a positive sum", e.Workload.HashMix)
+	}
+	if e.Workload.HashInitCap < 1 || e.Workload.HashLoadFactor < 1 {
+		return fmt.Errorf("hash map needs at least one bucket and a positive load factor, got %d and %d", e.Workload.HashInitCap, e.Workload.HashLoadFactor)
+	}
+	if e.Workload.ServHandPayload < 0 || e.Workload.ServHandPayload > ServHandMaxPayload || e.Workload.ServHandKeepAlive < 1 {
+		return fmt.Errorf("serv-hand needs a payload of at most %d bytes and at least one request per connection, got %d and %d",
+			ServHandMaxPayload, e.Workload.ServHandPayload, e.Workload.ServHandKeepAlive)
+	}
+	switch e.Workload.ServHandNetwork {
+	case "tcp", "unix", "pipe":
+	default:
+		return fmt.Errorf("unknown serv-hand network %q", e.Workload.ServHandNetwork)
+	}
+	if e.Workload.HTTPValues < 0 {
+		return fmt.Errorf("http needs a positive amount of values, got %d", e.Workload.HTTPValues)
+	}
+	if e.Workload.PipelineStages < 2 || e.Workload.PipelineBatch < 1 {
+		return fmt.Errorf("pipeline needs at least two stages and one record per batch, got %d and %d", e.Workload.PipelineStages, e.Workload.PipelineBatch)
+	}
+	if e.Workload.WorkerPoolScratch < 1 || e.Workload.WorkerPoolScratch > 1<<24 {
+		return fmt.Errorf("worker-pool needs a scratch slice of 1 to %d ints, got %d", 1<<24, e.Workload.WorkerPoolScratch)
+	}
+	if e.Workload.LRUShards < 1 || e.Workload.LRUShards > 1<<24 || e.Workload.LRUCapacity < 1 || e.Workload.LRUCapacity > 1<<24 {
+		return fmt.Errorf("lru-cache needs 1 to %d shards and entries per shard, got %d and %d", 1<<24, e.Workload.LRUShards, e.Workload.LRUCapacity)
+	}
+	if e.Workload.LRUHitRatio < 0 || e.Workload.LRUHitRatio > 100 || e.Workload.LRUEvictRate < 0 || e.Workload.LRUEvictRate > 100 {
+		return fmt.Errorf("lru-cache hit ratio and eviction rate are percentages, got %d and %d", e.Workload.LRUHitRatio, e.Workload.LRUEvictRate)
+	}
+	if e.Workload.LRUValueMin < 1 || e.Workload.LRUValueMax < e.Workload.LRUValueMin || e.Workload.LRUValueMax > 1<<24 {
+		return fmt.Errorf("lru-cache needs values of 1 to %d bytes with the smallest first, got %d and %d", 1<<24, e.Workload.LRUValueMin, e.Workload.LRUValueMax)
+	}
+	if e.Workload.GraphVertices < 1 || e.Workload.GraphDegree < 1 || 2*e.Workload.GraphVertices*e.Workload.GraphDegree > 1<<24 {
+		return fmt.Errorf("graph needs at least one vertex and edge per vertex and at most %d edges, got %d and %d", 1<<23, e.Workload.GraphVertices, e.Workload.GraphDegree)
+	}
+	switch e.Workload.GraphShape {
+	case "uniform", "power-law":
+	default:
+		return fmt.Errorf("unknown graph shape %q", e.Workload.GraphShape)
+	}
+	if e.Workload.JSONDocs < 1 || e.Workload.JSONItems < 0 {
+		return fmt.Errorf("json needs at least one document and no negative amount of items, got %d and %d", e.Workload.JSONDocs, e.Workload.JSONItems)
+	}
+	if e.Workload.StringOp < 0 {
+		return fmt.Errorf("string-builder needs a non-negative amount of lines, got %d", e.Workload.StringOp)
+	}
+	if e.Workload.StringFields < 1 || e.Workload.StringFlush < 1 {
+		return fmt.Errorf("string-builder needs at least one field per line and one line per log, got %d and %d", e.Workload.StringFields, e.Workload.StringFlush)
+	}
+	// The log of the region variant grows with allocSlice, which allocates at most 1<<24 bytes
+	if e.Workload.StringFlush > (1<<24)/maxLogLine(e.Workload.StringFields) {
+		return fmt.Errorf("string-builder log of %d lines with %d fields can exceed %d bytes", e.Workload.StringFlush, e.Workload.StringFields, 1<<24)
+	}
+	for _, size := range e.Workload.AllocSweepSizes {
+		if !validSweepSize(size) {
+			return fmt.Errorf("alloc-sweep size %d is not a power of two from 8 to %d bytes", size, 1<<24)
+		}
+	}
+	if e.Workload.AllocSweepCount < 1 || e.Workload.AllocSweepBudget < 1 {
+		return fmt.Errorf("alloc-sweep needs a positive count and budget, got %d and %d", e.Workload.AllocSweepCount, e.Workload.AllocSweepBudget)
+	}
+	// The region variant holds its objects in a slice from allocSlice
+	if e.Workload.AllocSweepCount > 1<<24 {
+		return fmt.Errorf("alloc-sweep count %d exceeds %d objects", e.Workload.AllocSweepCount, 1<<24)
+	}
+	if e.Workload.ChannelMessages < 1 {
+		return fmt.Errorf("channel-matrix needs at least one message per sender, got %d", e.Workload.ChannelMessages)
+	}
+	for _, p := range channelMatrixPrograms(e.Workload.ChannelBuffers, e.Workload.ChannelPayloads, e.Workload.ChannelRatios) {
+		if _, _, _, _, ok := parseChannelMatrix(p); !ok {
+			return fmt.Errorf("channel-matrix needs buffers of no negative size, power of two payloads from 8 to %d bytes and ratios like 1x4, got %s", 1<<15, p)
+		}
+	}
+	if e.Workload.LifecycleCycles < 1 {
+		return fmt.Errorf("region-lifecycle needs at least one cycle, got %d", e.Workload.LifecycleCycles)
+	}
+	for _, p := range lifecyclePrograms(e.Workload.LifecycleSizes, e.Workload.LifecycleObjects, e.Workload.LifecycleDepths) {
+		if _, _, _, ok := parseLifecycle(p); !ok {
+			return fmt.Errorf("region-lifecycle needs no negative sizes or objects and positive depths, got %s", p)
+		}
+	}
+	if e.Workload.NestedFanout < 0 || e.Workload.NestedDepth < 0 || e.Workload.NestedObjects < 0 {
+		return fmt.Errorf("nested-regions needs no negative fanout, depth or objects, got %d, %d and %d", e.Workload.NestedFanout, e.Workload.NestedDepth, e.Workload.NestedObjects)
+	}
+	switch e.Isolate {
+	case "none", "config", "round":
+	default:
+		return fmt.Errorf("unknown isolation %q", e.Isolate)
+	}
+	// The goroutines of a hung run keep running, so later runs must not share its process
+	if e.Deadline > 0 && e.Isolate == "none" {
+		return errors.New("a deadline needs -isolate config or round")
+	}
+	return nil
+}
+
+// maxLogLine returns the most bytes a string-builder line with up to fields
+// fields grows its buffer by: up to 8 message words, words of at most 10 bytes
+// and levels of at most 5, and the 20 bytes writeInt reserves for every number.
+func maxLogLine(fields int) int {
+	return len("ts=") + 20 + len(" level=") + 5 + len(" msg=\"") + 8*10 + 7 + len("\"") + fields*(len(" =")+10+20) + len("\n")
+}
+
+// saveExperiment writes the experiment next to its results, so the sweep that
+// produced them can be reproduced with -experiment.
+func saveExperiment() error {
+	b, err := json.MarshalIndent(exp, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(exp.Results, "experiment.json"), append(b, '\n'), 0644)
+}
@@ -0,0 +1,174 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// allocObjects allocates n objects of type T and keeps them alive until the
+// end of the run, so they stay on the heap. Only the objects are timed, the
+// slice that holds them is bookkeeping of the sweep.
+func allocObjects[T any](n int, done chan bool) {
+	objs := make([]*T, n)
+
+	for i := range objs {
+		allocationStart := time.Now()
+		objs[i] = new(T)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	}
+	done <- true
+}
+
+// sweepObjects returns allocObjects for objects of size bytes, made of bytes or
+// of pointers. Sizes are powers of two from 8 bytes to 16 MB.
+func sweepObjects(size int, pointers bool) func(int, chan bool) {
+	if pointers {
+		switch size {
+		case 1 << 3:
+			return allocObjects[[1 << 0]*byte]
+		case 1 << 4:
+			return allocObjects[[1 << 1]*byte]
+		case 1 << 5:
+			return allocObjects[[1 << 2]*byte]
+		case 1 << 6:
+			return allocObjects[[1 << 3]*byte]
+		case 1 << 7:
+			return allocObjects[[1 << 4]*byte]
+		case 1 << 8:
+			return allocObjects[[1 << 5]*byte]
+		case 1 << 9:
+			return allocObjects[[1 << 6]*byte]
+		case 1 << 10:
+			return allocObjects[[1 << 7]*byte]
+		case 1 << 11:
+			return allocObjects[[1 << 8]*byte]
+		case 1 << 12:
+			return allocObjects[[1 << 9]*byte]
+		case 1 << 13:
+			return allocObjects[[1 << 10]*byte]
+		case 1 << 14:
+			return allocObjects[[1 << 11]*byte]
+		case 1 << 15:
+			return allocObjects[[1 << 12]*byte]
+		case 1 << 16:
+			return allocObjects[[1 << 13]*byte]
+		case 1 << 17:
+			return allocObjects[[1 << 14]*byte]
+		case 1 << 18:
+			return allocObjects[[1 << 15]*byte]
+		case 1 << 19:
+			return allocObjects[[1 << 16]*byte]
+		case 1 << 20:
+			return allocObjects[[1 << 17]*byte]
+		case 1 << 21:
+			return allocObjects[[1 << 18]*byte]
+		case 1 << 22:
+			return allocObjects[[1 << 19]*byte]
+		case 1 << 23:
+			return allocObjects[[1 << 20]*byte]
+		case 1 << 24:
+			return allocObjects[[1 << 21]*byte]
+		}
+	} else {
+		switch size {
+		case 1 << 3:
+			return allocObjects[[1 << 3]byte]
+		case 1 << 4:
+			return allocObjects[[1 << 4]byte]
+		case 1 << 5:
+			return allocObjects[[1 << 5]byte]
+		case 1 << 6:
+			return allocObjects[[1 << 6]byte]
+		case 1 << 7:
+			return allocObjects[[1 << 7]byte]
+		case 1 << 8:
+			return allocObjects[[1 << 8]byte]
+		case 1 << 9:
+			return allocObjects[[1 << 9]byte]
+		case 1 << 10:
+			return allocObjects[[1 << 10]byte]
+		case 1 << 11:
+			return allocObjects[[1 << 11]byte]
+		case 1 << 12:
+			return allocObjects[[1 << 12]byte]
+		case 1 << 13:
+			return allocObjects[[1 << 13]byte]
+		case 1 << 14:
+			return allocObjects[[1 << 14]byte]
+		case 1 << 15:
+			return allocObjects[[1 << 15]byte]
+		case 1 << 16:
+			return allocObjects[[1 << 16]byte]
+		case 1 << 17:
+			return allocObjects[[1 << 17]byte]
+		case 1 << 18:
+			return allocObjects[[1 << 18]byte]
+		case 1 << 19:
+			return allocObjects[[1 << 19]byte]
+		case 1 << 20:
+			return allocObjects[[1 << 20]byte]
+		case 1 << 21:
+			return allocObjects[[1 << 21]byte]
+		case 1 << 22:
+			return allocObjects[[1 << 22]byte]
+		case 1 << 23:
+			return allocObjects[[1 << 23]byte]
+		case 1 << 24:
+			return allocObjects[[1 << 24]byte]
+		}
+	}
+	panic(fmt.Sprintf("alloc-sweep: no objects of %d bytes", size))
+}
+
+// sweepCount is the amount of objects of size bytes allocated by a run, at most
+// AllocSweepCount and at most AllocSweepBudget bytes.
+func sweepCount(size int) int {
+	return max(min(AllocSweepCount, AllocSweepBudget/size), 1)
+}
+
+func RunAllocSweep(size int, pointers bool) SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	alloc := sweepObjects(size, pointers)
+	count := sweepCount(size)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	done := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	// The objects are split evenly over the goroutines
+	for i := 0; i < Goroutines; i++ {
+		n := count / Goroutines
+		if i < count%Goroutines {
+			n++
+		}
+		go alloc(n, done)
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(count) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
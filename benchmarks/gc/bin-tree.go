@@ -2,8 +2,11 @@ package gc
 
 import (
 	. "experiments/benchmarks/metrics"
+	"math"
+	"math/rand/v2"
 	"runtime"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,15 +16,29 @@ const (
 	OpInsert opType = iota
 	OpSearch
 	OpRemove
+	// Removes the smallest value of a subtree, used to find the successor of a removed value
+	opRemoveMin
 )
 
 type request struct {
 	value        int
 	op           opType
 	result       chan bool
+	removed      chan removal
 	latencyStart time.Time
 }
 
+// A removal is the answer of a node to a remove sent by its parent, which
+// waits for it before handling its next request.
+type removal struct {
+	// Subtree replacing the one the remove was sent to
+	node *Node
+	// Node unlinked from the tree, its goroutine is stopping
+	freed *Node
+	// Value of the freed node
+	value int
+}
+
 type Node struct {
 	value int
 	left  *Node
@@ -34,11 +51,14 @@ type FineGrainBinaryTree struct {
 	root *Node
 	reqs chan request
 	done chan bool
+	// Values inserted minus values removed, only counted with Verify
+	size atomic.Int64
 }
 
 func (n *Node) run(req *request) {
 	allocationStart := time.Now()
 	req = new(request)
+	removed := make(chan removal)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
 	for *req = range n.reqs {
@@ -100,11 +120,79 @@ func (n *Node) run(req *request) {
 				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 				req.result <- false
 			}
+		case OpRemove:
+			parent := req.removed
+			if req.value < n.value && n.left != nil {
+				req.removed = removed
+				n.left.reqs <- *req
+				rem := <-removed
+				n.left = rem.node
+				rem.freed.free()
+				parent <- removal{node: n}
+			} else if req.value > n.value && n.right != nil {
+				req.removed = removed
+				n.right.reqs <- *req
+				rem := <-removed
+				n.right = rem.node
+				rem.freed.free()
+				parent <- removal{node: n}
+			} else if req.value != n.value {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- false
+				parent <- removal{node: n}
+			} else if n.left != nil && n.right != nil {
+				// Take over the value of the successor, which is removed instead
+				n.right.reqs <- request{op: opRemoveMin, removed: removed}
+				rem := <-removed
+				n.value = rem.value
+				n.right = rem.node
+				rem.freed.free()
+
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- true
+				parent <- removal{node: n}
+			} else {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- true
+				n.unlink(parent)
+				return
+			}
+		case opRemoveMin:
+			parent := req.removed
+			if n.left != nil {
+				req.removed = removed
+				n.left.reqs <- *req
+				rem := <-removed
+				n.left = rem.node
+				rem.freed.free()
+				parent <- removal{node: n, value: rem.value}
+			} else {
+				n.unlink(parent)
+				return
+			}
 		}
 	}
 	n.done <- true
 }
 
+// unlink replaces n by its only child, if any, and stops the goroutine of n.
+func (n *Node) unlink(parent chan removal) {
+	child := n.left
+	if child == nil {
+		child = n.right
+	}
+	parent <- removal{node: child, freed: n, value: n.value}
+	n.done <- true
+}
+
+// free waits for the goroutine of a node unlinked from the tree to stop,
+// after which the node is garbage.
+func (n *Node) free() {
+	if n != nil {
+		<-n.done
+	}
+}
+
 func NewFineGrainBinaryTree() *FineGrainBinaryTree {
 	allocationStart := time.Now()
 	t := new(FineGrainBinaryTree)
@@ -121,6 +209,7 @@ func NewFineGrainBinaryTree() *FineGrainBinaryTree {
 func (t *FineGrainBinaryTree) run(req *request) {
 	allocationStart := time.Now()
 	req = new(request)
+	removed := make(chan removal)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
 	for *req = range t.reqs {
@@ -151,48 +240,99 @@ func (t *FineGrainBinaryTree) run(req *request) {
 			} else {
 				t.root.reqs <- *req
 			}
+		case OpRemove:
+			if t.root == nil {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- false
+			} else {
+				req.removed = removed
+				t.root.reqs <- *req
+				rem := <-removed
+				t.root = rem.node
+				rem.freed.free()
+			}
 		}
 	}
 	t.done <- true
 }
 
-func (tree *FineGrainBinaryTree) Insert(value int, req request) {
+func (tree *FineGrainBinaryTree) Insert(value int, req request) bool {
 	req.value = value
 	req.op = OpInsert
 	req.latencyStart = time.Now()
 
 	tree.reqs <- req
-	<-req.result
+	return <-req.result
 }
 
-func (tree *FineGrainBinaryTree) Search(value int, req request) {
+func (tree *FineGrainBinaryTree) Search(value int, req request) bool {
 	req.value = value
 	req.op = OpSearch
 	req.latencyStart = time.Now()
 
 	tree.reqs <- req
-	<-req.result
+	return <-req.result
 }
 
-func generateBinaryTreeOperations(valueRange int, op int, tree *FineGrainBinaryTree, done chan bool, req *request, i *int) {
+func (tree *FineGrainBinaryTree) Remove(value int, req request) bool {
+	req.value = value
+	req.op = OpRemove
+	req.latencyStart = time.Now()
+
+	tree.reqs <- req
+	return <-req.result
+}
+
+func generateBinaryTreeOperations(id int, valueRange int, op int, tree *FineGrainBinaryTree, done chan bool, req *request, i *int) {
 	allocationStart := time.Now()
 	req = new(request)
 	req.result = make(chan bool)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id)))
+	keys := new(KeyGenerator)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
+	keys.Init(BinKeys, valueRange, BinRange, rng)
+
 	for i = new(int); *i < op; *i++ {
-		tree.Insert(*i + valueRange, *req)
-		/*val := rand.IntN(valueRange) + 1
-		switch method := opType(rand.IntN(2)); method {
+		switch opType(BinMix.Pick(rng)) {
 		case OpInsert:
-			tree.Insert(val, *req)
+			if tree.Insert(keys.Insert(), *req) && Verify {
+				tree.size.Add(1)
+			}
 		case OpSearch:
-			tree.Search(val, *req)
-		}*/
+			tree.Search(keys.Existing(), *req)
+		case OpRemove:
+			if tree.Remove(keys.Existing(), *req) && Verify {
+				tree.size.Add(-1)
+			}
+		}
 	}
 	done <- true
 }
 
+// validate checks that the tree is a binary search tree holding the values that
+// were inserted and not removed, and fails the run otherwise.
+func (tree *FineGrainBinaryTree) validate() {
+	count := 0
+	if !tree.root.check(math.MinInt, math.MaxInt, &count) {
+		Fail("bin-tree: values are out of order or stored twice")
+		return
+	}
+	if int64(count) != tree.size.Load() {
+		Fail("bin-tree: holds %d values, expected %d", count, tree.size.Load())
+	}
+}
+
+// check counts the nodes of the subtree of n and reports whether their values
+// are ordered and within (lo, hi).
+func (n *Node) check(lo int, hi int, count *int) bool {
+	if n == nil {
+		return true
+	}
+	*count++
+	return lo < n.value && n.value < hi && n.left.check(lo, n.value, count) && n.right.check(n.value, hi, count)
+}
+
 func (n *Node) destroyTree() {
 	close(n.reqs)
 	<-n.done
@@ -205,7 +345,7 @@ func (n *Node) destroyTree() {
 }
 
 func RunBinaryTree(op int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -213,8 +353,8 @@ func RunBinaryTree(op int) SystemMetrics {
 	Latency.Store(0)
 
 	// To avoid escape analysis
-	reqs := [Goroutines]request{}
-	c := [Goroutines]int{}
+	reqs := make([]request, Goroutines)
+	c := make([]int, Goroutines)
 
 	computationTimeStart := time.Now()
 
@@ -226,7 +366,7 @@ func RunBinaryTree(op int) SystemMetrics {
 
 	valueRange := 0
 	for i := 0; i < Goroutines; i++ {
-		go generateBinaryTreeOperations(valueRange, op, fgbt, done, &reqs[i], &c[i])
+		go generateBinaryTreeOperations(i, valueRange, op, fgbt, done, &reqs[i], &c[i])
 		valueRange += BinOp
 	}
 
@@ -234,16 +374,26 @@ func RunBinaryTree(op int) SystemMetrics {
 		<-done
 	}
 
-	// Decrement each reference counter
-	fgbt.root.destroyTree()
+	// The tree is only validated once its goroutine finished the last remove
 	close(fgbt.reqs)
 	<-fgbt.done
 
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		fgbt.validate()
+		verification = time.Since(verificationStart)
+	}
+
+	if fgbt.root != nil {
+		fgbt.root.destroyTree()
+	}
+
 	deallocationStart := time.Now()
 	runtime.GC()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
 
 	return SystemMetrics{
 		float64(ComputationTime.Load()),
@@ -0,0 +1,127 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A message is sent by value, so no message is allocated and only the channel
+// is left to the memory manager.
+type message[T any] struct {
+	latencyStart time.Time
+	payload      T
+}
+
+func sendMessages[T any](ch chan message[T], done chan bool, i *int) {
+	var msg message[T]
+	for i = new(int); *i < ChannelMessages; *i++ {
+		msg.latencyStart = time.Now()
+		ch <- msg
+		SendLatency.Record(time.Since(msg.latencyStart).Nanoseconds())
+	}
+	done <- true
+}
+
+func receiveMessages[T any](ch chan message[T], done chan bool) {
+	for {
+		receiveStart := time.Now()
+		msg, ok := <-ch
+		if !ok {
+			break
+		}
+		ReceiveLatency.Record(time.Since(receiveStart).Nanoseconds())
+		Latency.Add(time.Since(msg.latencyStart).Nanoseconds())
+	}
+	done <- true
+}
+
+// runChannelMatrix sends ChannelMessages messages of type T from every sender
+// over one channel of buffer slots, with senders senders and receivers
+// receivers for every goroutine.
+func runChannelMatrix[T any](buffer int, senders int, receivers int) SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	senders *= Goroutines
+	receivers *= Goroutines
+
+	// To avoid escape analysis
+	c := make([]int, senders)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	ch := make(chan message[T], buffer)
+	doneSenders := make(chan bool)
+	doneReceivers := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < senders; i++ {
+		go sendMessages(ch, doneSenders, &c[i])
+	}
+	for i := 0; i < receivers; i++ {
+		go receiveMessages(ch, doneReceivers)
+	}
+
+	for i := 0; i < senders; i++ {
+		<-doneSenders
+	}
+	close(ch)
+	for i := 0; i < receivers; i++ {
+		<-doneReceivers
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(ChannelMessages*senders) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
+
+// RunChannelMatrix runs runChannelMatrix with payloads of payload bytes, a
+// power of two from 8 bytes to 32 KB.
+func RunChannelMatrix(buffer int, payload int, senders int, receivers int) SystemMetrics {
+	switch payload {
+	case 8:
+		return runChannelMatrix[[8]byte](buffer, senders, receivers)
+	case 16:
+		return runChannelMatrix[[16]byte](buffer, senders, receivers)
+	case 32:
+		return runChannelMatrix[[32]byte](buffer, senders, receivers)
+	case 64:
+		return runChannelMatrix[[64]byte](buffer, senders, receivers)
+	case 128:
+		return runChannelMatrix[[128]byte](buffer, senders, receivers)
+	case 256:
+		return runChannelMatrix[[256]byte](buffer, senders, receivers)
+	case 512:
+		return runChannelMatrix[[512]byte](buffer, senders, receivers)
+	case 1024:
+		return runChannelMatrix[[1024]byte](buffer, senders, receivers)
+	case 2048:
+		return runChannelMatrix[[2048]byte](buffer, senders, receivers)
+	case 4096:
+		return runChannelMatrix[[4096]byte](buffer, senders, receivers)
+	case 8192:
+		return runChannelMatrix[[8192]byte](buffer, senders, receivers)
+	case 16384:
+		return runChannelMatrix[[16384]byte](buffer, senders, receivers)
+	case 32768:
+		return runChannelMatrix[[32768]byte](buffer, senders, receivers)
+	}
+	panic(fmt.Sprintf("channel-matrix: no payload of %d bytes", payload))
+}
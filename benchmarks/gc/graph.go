@@ -0,0 +1,186 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A Vertex points at its neighbours, the graph is undirected so every edge is
+// held by both of its vertices.
+type Vertex struct {
+	id    int
+	edges []*Vertex
+}
+
+// generateEdges returns the endpoints of the edges of the graph, edge e joins
+// ends[2e] and ends[2e+1]. Every vertex adds GraphDegree edges, to uniformly
+// drawn vertices or, for a power-law graph, to the ends of uniformly drawn
+// edges, which attaches vertices to the vertices that already have many.
+func generateEdges(rng *rand.Rand) []int {
+	allocationStart := time.Now()
+	ends := make([]int, 2*GraphVertices*GraphDegree)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for n := 0; n < len(ends); n += 2 {
+		ends[n] = n / 2 / GraphDegree
+		ends[n+1] = rng.IntN(GraphVertices)
+		if GraphShape == "power-law" && n > 0 {
+			ends[n+1] = ends[rng.IntN(n)]
+		}
+	}
+	return ends
+}
+
+// generateGraph builds the graph, the edges it is built from are garbage once it is.
+func generateGraph() []*Vertex {
+	ends := generateEdges(rand.New(rand.NewPCG(Seed, 0)))
+
+	allocationStart := time.Now()
+	degrees := make([]int, GraphVertices)
+	graph := make([]*Vertex, GraphVertices)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for _, v := range ends {
+		degrees[v]++
+	}
+	for v := range graph {
+		allocationStart = time.Now()
+		graph[v] = new(Vertex)
+		graph[v].edges = make([]*Vertex, 0, degrees[v])
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		graph[v].id = v
+	}
+	for e := 0; e < len(ends); e += 2 {
+		from, to := graph[ends[e]], graph[ends[e+1]]
+		from.edges = append(from.edges, to)
+		to.edges = append(to.edges, from)
+	}
+	return graph
+}
+
+// components labels every vertex with its connected component and returns the
+// size of every component.
+func components(graph []*Vertex) ([]int, []int) {
+	label := make([]int, len(graph))
+	for v := range label {
+		label[v] = -1
+	}
+	var sizes []int
+	var stack []*Vertex
+	for _, s := range graph {
+		if label[s.id] >= 0 {
+			continue
+		}
+		label[s.id] = len(sizes)
+		sizes = append(sizes, 0)
+		stack = append(stack, s)
+		for len(stack) > 0 {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sizes[len(sizes)-1]++
+			for _, w := range v.edges {
+				if label[w.id] < 0 {
+					label[w.id] = label[s.id]
+					stack = append(stack, w)
+				}
+			}
+		}
+	}
+	return label, sizes
+}
+
+// bfs returns the amount of vertices reachable from source. The frontier and
+// the visited set of the traversal are garbage once it is done.
+func bfs(graph []*Vertex, source *Vertex) int {
+	allocationStart := time.Now()
+	visited := make([]bool, len(graph))
+	frontier := make([]*Vertex, len(graph))
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	visited[source.id] = true
+	frontier[0] = source
+	head, tail := 0, 1
+	for head < tail {
+		v := frontier[head]
+		head++
+		for _, w := range v.edges {
+			if !visited[w.id] {
+				visited[w.id] = true
+				frontier[tail] = w
+				tail++
+			}
+		}
+	}
+	return tail
+}
+
+func generateGraphQueries(id int, graph []*Vertex, label []int, sizes []int, done chan bool, i *int) {
+	allocationStart := time.Now()
+	i = new(int)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id+1)))
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for *i = 0; *i < GraphQueries; *i++ {
+		source := graph[rng.IntN(len(graph))]
+
+		latencyStart := time.Now()
+		reached := bfs(graph, source)
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		if Verify && reached != sizes[label[source.id]] {
+			Fail("graph: bfs from %d reached %d vertices, its component has %d", source.id, reached, sizes[label[source.id]])
+		}
+	}
+	done <- true
+}
+
+func RunGraph() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	done := make(chan bool)
+	c := make([]int, Goroutines)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	graph := generateGraph()
+
+	var verification time.Duration
+	var label, sizes []int
+	if Verify {
+		verificationStart := time.Now()
+		label, sizes = components(graph)
+		verification = time.Since(verificationStart)
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		go generateGraphQueries(i, graph, label, sizes, done, &c[i])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(GraphQueries*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -2,8 +2,10 @@ package gc
 
 import (
 	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
 	"runtime"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,24 +31,25 @@ func (l *list) push(v int) bool {
 	return l.next.push(v)
 }
 
-func (l *list) valueShift() {
-	if l.next != nil && l.next.value != 0 {
-		l.value = l.next.value
-		l.next.valueShift()
-	} else {
-		l.value = 0
-	}
-}
-
+// remove takes v out of the chain that starts at l. The head of the chain stays
+// in its bucket and takes over the value of its successor instead, any other
+// node is unlinked, so every remove leaves a node to the GC.
 func (l *list) remove(v int) bool {
-	if l.value != v {
+	if l.value == v {
 		if l.next == nil {
-			return false
+			l.value = 0
+		} else {
+			l.value, l.next = l.next.value, l.next.next
 		}
-		return l.next.remove(v)
+		return true
 	}
-	l.valueShift()
-	return true
+	for prev, e := l, l.next; e != nil; prev, e = e, e.next {
+		if e.value == v {
+			prev.next = e.next
+			return true
+		}
+	}
+	return false
 }
 
 type bucket struct {
@@ -58,6 +61,8 @@ type bucket struct {
 type FineGrainedMap struct {
 	buckets []*bucket
 	size    int
+	// Values inserted minus values deleted, only counted with Verify
+	values atomic.Int64
 }
 
 func (b bucket) add(value int) bool {
@@ -147,6 +152,31 @@ func (m *FineGrainedMap) Delete(value int, idx int, res chan bool) bool {
 	return <-res
 }
 
+// validate checks that every value is stored once, in the bucket of its hash,
+// and that the map holds the values that were inserted and not deleted. It
+// fails the run otherwise.
+func (m *FineGrainedMap) validate() {
+	count := 0
+	for i, b := range m.buckets {
+		for e := b.store; e != nil && e.value != 0; e = e.next {
+			if m.hashKey(e.value) != i {
+				Fail("hash-map: %d is in bucket %d instead of %d", e.value, i, m.hashKey(e.value))
+				return
+			}
+			for d := e.next; d != nil && d.value != 0; d = d.next {
+				if d.value == e.value {
+					Fail("hash-map: %d is stored twice", e.value)
+					return
+				}
+			}
+			count++
+		}
+	}
+	if int64(count) != m.values.Load() {
+		Fail("hash-map: holds %d values, expected %d", count, m.values.Load())
+	}
+}
+
 func closeBuckets(m *FineGrainedMap) {
 	for i := range m.buckets {
 		close(m.buckets[i].requests)
@@ -154,39 +184,44 @@ func closeBuckets(m *FineGrainedMap) {
 	}
 }
 
-func generateHashMapOperations(m *FineGrainedMap, valueRange int, op int, done chan bool, i *int) {
+func generateHashMapOperations(id int, m *FineGrainedMap, valueRange int, op int, done chan bool, i *int) {
 	allocationTimeStart := time.Now()
 	idx := new(int)
 	res := make(chan bool)
 	req := new(request)
 	i = new(int)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id)))
+	keys := new(KeyGenerator)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
+	keys.Init(HashKeys, valueRange, HashRange*Goroutines, rng)
+
 	for *i = 0; *i < op; *i++ {
-		m.Insert(*i + valueRange, *idx, res, *req)
-		/*
-		val := rand.IntN(valueRange) + 1
-		switch method := opType(rand.IntN(3)); method {
+		switch opType(HashMix.Pick(rng)) {
 		case OpInsert:
-			m.Insert(val, *idx, res)
+			if m.Insert(keys.Insert(), *idx, res, *req) && Verify {
+				m.values.Add(1)
+			}
 		case OpSearch:
-			m.Search(val, *idx, res)
+			m.Search(keys.Existing(), *idx, res)
 		case OpRemove:
-			m.Delete(val, *idx, res)
-		}*/
+			if m.Delete(keys.Existing(), *idx, res) && Verify {
+				m.values.Add(-1)
+			}
+		}
 	}
 	done <- true
 }
 
 func RunHashMap() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
 	DeallocationTime.Store(0)
 	Latency.Store(0)
 
-	c := [Goroutines + 1]int{}
+	c := make([]int, Goroutines+1)
 	computationTimeStart := time.Now()
 
 	allocationTimeStart := time.Now()
@@ -197,7 +232,7 @@ func RunHashMap() SystemMetrics {
 
 	valueRange := 0
 	for i := 0; i < Goroutines; i++ {
-		go generateHashMapOperations(m, valueRange, HashOp, done, &c[i])
+		go generateHashMapOperations(i, m, valueRange, HashOp, done, &c[i])
 		valueRange += HashOp
 	}
 
@@ -205,13 +240,20 @@ func RunHashMap() SystemMetrics {
 		<-done
 	}
 
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		m.validate()
+		verification = time.Since(verificationStart)
+	}
+
 	closeBuckets(m)
 
 	deallocationStart := time.Now()
 	runtime.GC()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
 
 	return SystemMetrics{
 		float64(ComputationTime.Load()),
@@ -0,0 +1,154 @@
+package gc
+
+import (
+	"bytes"
+	"encoding/json"
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+type httpRequest struct {
+	ID     int
+	Values []int
+}
+
+type httpResponse struct {
+	ID    int
+	Sum   int
+	Count int
+}
+
+// An exchange holds everything a handler allocates for one request.
+type exchange struct {
+	in  httpRequest
+	out httpResponse
+}
+
+// handleSum answers a request with the sum of its values.
+func handleSum(w http.ResponseWriter, r *http.Request) {
+	allocationTimeStart := time.Now()
+	ex := new(exchange)
+	ex.in.Values = make([]int, 0, HTTPValues)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	if err := json.NewDecoder(r.Body).Decode(&ex.in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ex.out.ID = ex.in.ID
+	ex.out.Count = len(ex.in.Values)
+	for _, v := range ex.in.Values {
+		ex.out.Sum += v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&ex.out)
+}
+
+// sendHTTPRequests posts op requests of HTTPValues values and checks the sums
+// in the responses. The client keeps its connection alive between requests.
+func sendHTTPRequests(id int, op int, client *http.Client, url string, done chan bool, i *int) {
+	allocationTimeStart := time.Now()
+	req := new(httpRequest)
+	req.Values = make([]int, HTTPValues)
+	resp := new(httpResponse)
+	body := new(bytes.Buffer)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	for i = new(int); *i < op; *i++ {
+		req.ID = id*op + *i
+		sum := 0
+		for j := range req.Values {
+			req.Values[j] = req.ID + j
+			sum += req.Values[j]
+		}
+
+		body.Reset()
+		json.NewEncoder(body).Encode(req)
+
+		latencyStart := time.Now()
+		res, err := client.Post(url, "application/json", body)
+		if err != nil {
+			Fail("http: %v", err)
+			break
+		}
+		err = json.NewDecoder(res.Body).Decode(resp)
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		if err != nil {
+			Fail("http: %v", err)
+			break
+		}
+		if resp.ID != req.ID || resp.Sum != sum || resp.Count != HTTPValues {
+			Fail("http: request %d answered as %d with sum %d of %d values, expected sum %d of %d", req.ID, resp.ID, resp.Sum, resp.Count, sum, HTTPValues)
+		}
+	}
+	done <- true
+}
+
+func RunHTTPServer() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// Bypassing escaping
+	c := make([]int, Goroutines)
+
+	computationTimeStart := time.Now()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		Fail("http: %v", err)
+		return SystemMetrics{}
+	}
+
+	allocationTimeStart := time.Now()
+	done := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sum", handleSum)
+	server := &http.Server{Handler: mux}
+	transport := &http.Transport{MaxIdleConnsPerHost: Goroutines}
+	client := &http.Client{Transport: transport}
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String() + "/sum"
+	for i := 0; i < Goroutines; i++ {
+		go sendHTTPRequests(i, HTTPOp, client, url, done, &c[i])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	transport.CloseIdleConnections()
+	if server.Close() != nil {
+		fmt.Println("Could not stop server")
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(HTTPOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,298 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// A jsonNode is a value in the parse tree of a document. Objects and arrays
+// hold their members as a list of children, strings and keys point into the
+// buffer the document was read into.
+type jsonNode struct {
+	kind  byte // '{', '[', '"' or '0' for a number
+	key   []byte
+	str   []byte
+	num   int
+	child *jsonNode
+	last  *jsonNode
+	next  *jsonNode
+}
+
+var totalKey = []byte("total")
+
+func newJSONNode(kind byte) *jsonNode {
+	allocationStart := time.Now()
+	n := new(jsonNode)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	n.kind = kind
+	return n
+}
+
+func (n *jsonNode) add(child *jsonNode) {
+	if n.last == nil {
+		n.child = child
+	} else {
+		n.last.next = child
+	}
+	n.last = child
+}
+
+// member returns the member of object n named key.
+func (n *jsonNode) member(key string) *jsonNode {
+	for c := n.child; c != nil; c = c.next {
+		if string(c.key) == key {
+			return c
+		}
+	}
+	return nil
+}
+
+func skipSpace(buf []byte, pos *int) {
+	for *pos < len(buf) && (buf[*pos] == ' ' || buf[*pos] == '\n' || buf[*pos] == '\t' || buf[*pos] == '\r') {
+		*pos++
+	}
+}
+
+// peek returns the byte at *pos, or 0 past the end of buf.
+func peek(buf []byte, pos *int) byte {
+	if *pos < len(buf) {
+		return buf[*pos]
+	}
+	return 0
+}
+
+// parseString returns the string starting at the quote at *pos, escapes are
+// kept as they are. It reports false if there is no complete string at *pos.
+func parseString(buf []byte, pos *int) ([]byte, bool) {
+	if peek(buf, pos) != '"' {
+		return nil, false
+	}
+	*pos++
+	start := *pos
+	for peek(buf, pos) != '"' {
+		if *pos >= len(buf) {
+			return nil, false
+		}
+		if buf[*pos] == '\\' {
+			*pos++
+		}
+		*pos++
+	}
+	*pos++
+	return buf[start : *pos-1], true
+}
+
+// parseValue parses the value at *pos into a tree of jsonNodes. Only the
+// objects, arrays, strings and integers documents are made of are supported,
+// anything else is malformed and returns nil.
+func parseValue(buf []byte, pos *int) *jsonNode {
+	skipSpace(buf, pos)
+	switch peek(buf, pos) {
+	case '{':
+		n := newJSONNode('{')
+		*pos++
+		for skipSpace(buf, pos); peek(buf, pos) != '}'; skipSpace(buf, pos) {
+			if n.child != nil {
+				if peek(buf, pos) != ',' {
+					return nil
+				}
+				*pos++
+				skipSpace(buf, pos)
+			}
+			key, ok := parseString(buf, pos)
+			skipSpace(buf, pos)
+			if !ok || peek(buf, pos) != ':' {
+				return nil
+			}
+			*pos++
+			c := parseValue(buf, pos)
+			if c == nil {
+				return nil
+			}
+			c.key = key
+			n.add(c)
+		}
+		*pos++
+		return n
+	case '[':
+		n := newJSONNode('[')
+		*pos++
+		for skipSpace(buf, pos); peek(buf, pos) != ']'; skipSpace(buf, pos) {
+			if n.child != nil {
+				if peek(buf, pos) != ',' {
+					return nil
+				}
+				*pos++
+			}
+			c := parseValue(buf, pos)
+			if c == nil {
+				return nil
+			}
+			n.add(c)
+		}
+		*pos++
+		return n
+	case '"':
+		n := newJSONNode('"')
+		var ok bool
+		if n.str, ok = parseString(buf, pos); !ok {
+			return nil
+		}
+		return n
+	}
+	n := newJSONNode('0')
+	start := *pos
+	for c := peek(buf, pos); c == '-' || c >= '0' && c <= '9'; c = peek(buf, pos) {
+		*pos++
+	}
+	var err error
+	if n.num, err = strconv.Atoi(string(buf[start:*pos])); err != nil {
+		return nil
+	}
+	return n
+}
+
+// encodeNode appends n to out as compact JSON.
+func encodeNode(out []byte, n *jsonNode) []byte {
+	if n.key != nil {
+		out = append(out, '"')
+		out = append(out, n.key...)
+		out = append(out, '"', ':')
+	}
+	switch n.kind {
+	case '{', '[':
+		out = append(out, n.kind)
+		for c := n.child; c != nil; c = c.next {
+			out = encodeNode(out, c)
+			if c.next != nil {
+				out = append(out, ',')
+			}
+		}
+		return append(out, n.kind+2) // '}' and ']'
+	case '"':
+		out = append(out, '"')
+		out = append(out, n.str...)
+		return append(out, '"')
+	}
+	return strconv.AppendInt(out, int64(n.num), 10)
+}
+
+// transformDocument drops the items of doc without a quantity and adds the
+// total price of the rest to it. It reports false if doc is not a document.
+func transformDocument(doc *jsonNode) bool {
+	if doc.kind != '{' {
+		return false
+	}
+	items := doc.member("items")
+	if items == nil || items.kind != '[' {
+		return false
+	}
+	total := 0
+	var prev *jsonNode
+	for item := items.child; item != nil; item = item.next {
+		quantity, price := item.member("quantity"), item.member("price")
+		if quantity == nil || price == nil {
+			return false
+		}
+		if quantity.num == 0 {
+			if prev == nil {
+				items.child = item.next
+			} else {
+				prev.next = item.next
+			}
+			continue
+		}
+		total += price.num * quantity.num
+		prev = item
+	}
+	items.last = prev
+
+	n := newJSONNode('0')
+	n.key = totalKey
+	n.num = total
+	doc.add(n)
+	return true
+}
+
+func processDocuments(id int, docs [][]byte, expected []uint32, done chan bool, i *int) {
+	allocationStart := time.Now()
+	i = new(int)
+	pos := new(int)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for *i = 0; *i < JSONDocs; *i++ {
+		d := (id + *i) % len(docs)
+		latencyStart := time.Now()
+
+		allocationStart = time.Now()
+		buf := make([]byte, len(docs[d]))
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+		copy(buf, docs[d])
+
+		*pos = 0
+		doc := parseValue(buf, pos)
+		if doc == nil || !transformDocument(doc) {
+			Fail("json: document %d is malformed", d)
+			break
+		}
+
+		allocationStart = time.Now()
+		out := make([]byte, 0, len(buf)+64)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+		out = encodeNode(out, doc)
+
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		if Verify && Checksum(out) != expected[d] {
+			Fail("json: document %d was transformed into %q", d, out)
+		}
+	}
+	done <- true
+}
+
+func RunJSON() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// The corpus is the input of the workload, it is not part of what is measured
+	docs, expected := GenerateDocuments(JSONDocs, JSONItems, rand.New(rand.NewPCG(Seed, 0)))
+
+	// To avoid escape analysis
+	c := make([]int, Goroutines)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	done := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < Goroutines; i++ {
+		go processDocuments(i, docs, expected, done, &c[i])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(JSONDocs*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
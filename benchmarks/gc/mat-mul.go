@@ -19,10 +19,13 @@ type position struct {
 	latencyStart time.Time
 }
 
-func generateMatrix(valueRange int) []*[]*int {
+// generateMatrix returns a matrix of values from [1, valueRange], drawn from
+// stream id of the seed, so both memory managers multiply the same matrices.
+func generateMatrix(id int, valueRange int) []*[]*int {
 	allocationStart := time.Now()
 	matrix := make([]*[]*int, Rows)
 	j := new(int)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id)))
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
 	for i := new(int); *i < len(matrix); *i++ {
@@ -35,15 +38,17 @@ func generateMatrix(valueRange int) []*[]*int {
 			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 			(*matrix[*i])[*j] = new(int)
 			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
-			*(*matrix[*i])[*j] = rand.IntN(valueRange)
+			*(*matrix[*i])[*j] = rng.IntN(valueRange) + 1
 		}
 	}
 	return matrix
 }
 
-func matrixMultiplication(m1 []*[]*int, m2 []*[]*int, done chan bool, result *[]*[]int) {
+// matrixMultiplication multiplies m1 and m2 into result and returns the time
+// spent verifying the result, which does not count as computation.
+func matrixMultiplication(m1 []*[]*int, m2 []*[]*int, done chan bool, result *[]*[]int) time.Duration {
 	if len(*m1[0]) != len(m2) {
-		return
+		return 0
 	}
 	r1 := len(m1)
 	c2 := len(*m2[0])
@@ -86,6 +91,30 @@ func matrixMultiplication(m1 []*[]*int, m2 []*[]*int, done chan bool, result *[]
 
 	close(positions)
 	<-done
+
+	if !Verify {
+		return 0
+	}
+	verificationStart := time.Now()
+	verifyProduct(m1, m2, *result)
+	return time.Since(verificationStart)
+}
+
+// verifyProduct recomputes the product of m1 and m2 on a single goroutine and
+// fails the run if result differs from it.
+func verifyProduct(m1 []*[]*int, m2 []*[]*int, result []*[]int) {
+	for i := range m1 {
+		for j := range *result[i] {
+			expected := 0
+			for k := range m2 {
+				expected += *(*m1[i])[k] * *(*m2[k])[j]
+			}
+			if got := (*result[i])[j]; got != expected {
+				Fail("mat-mul: result[%d][%d] is %d, expected %d", i, j, got, expected)
+				return
+			}
+		}
+	}
 }
 
 func calculateProduct(row []*int, col []*int, k *int, p *int) *int {
@@ -135,7 +164,7 @@ func calculateProducts(m1 []*[]*int, m2 []*[]*int, products chan product, positi
 }
 
 func RunMatrixMultiplication(valueRange int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	AllocationTime.Store(0)
 	DeallocationTime.Store(0)
@@ -147,11 +176,11 @@ func RunMatrixMultiplication(valueRange int) SystemMetrics {
 	done := make(chan bool)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
-	m1 := generateMatrix(valueRange)
-	m2 := generateMatrix(valueRange)
+	m1 := generateMatrix(0, valueRange)
+	m2 := generateMatrix(1, valueRange)
 
 	var res []*[]int
-	matrixMultiplication(m1, m2, done, &res)
+	verification := matrixMultiplication(m1, m2, done, &res)
 
 	for i := 0; i < Goroutines; i++ {
 		<-done
@@ -162,7 +191,7 @@ func RunMatrixMultiplication(valueRange int) SystemMetrics {
 	runtime.GC()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	computationTime := float64(time.Since(start).Nanoseconds())
+	computationTime := float64((time.Since(start) - verification).Nanoseconds())
 
 	throughput := float64(Rows*Cols) / float64(computationTime)
 
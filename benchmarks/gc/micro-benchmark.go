@@ -8,7 +8,7 @@ import (
 )
 
 func RunAlloc() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -46,7 +46,7 @@ type payload struct {
 }
 
 func RunChannel() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -0,0 +1,124 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A taskObject is allocated by a request or one of its sub-tasks.
+type taskObject struct {
+	value int
+	next  *taskObject
+	buf   [48]byte
+}
+
+// runTask runs a task of a request. It allocates NestedObjects objects, runs
+// NestedFanout sub-tasks until NestedDepth and hands its result to the task
+// that started it in a new object, after which its own objects are garbage.
+func runTask(level int, id int) *taskObject {
+	var head *taskObject
+	for i := 0; i < NestedObjects; i++ {
+		allocationStart := time.Now()
+		o := new(taskObject)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		o.value = id + i
+		o.next = head
+		head = o
+	}
+
+	sum := 0
+	for o := head; o != nil; o = o.next {
+		sum += o.value
+	}
+	if level < NestedDepth {
+		for f := 0; f < NestedFanout; f++ {
+			sum += runTask(level+1, id*NestedFanout+f).value
+		}
+	}
+
+	allocationStart := time.Now()
+	result := new(taskObject)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	result.value = sum
+
+	return result
+}
+
+// expectedTask is the result of runTask, computed without allocating.
+func expectedTask(level int, id int) int {
+	sum := NestedObjects*id + NestedObjects*(NestedObjects-1)/2
+	if level < NestedDepth {
+		for f := 0; f < NestedFanout; f++ {
+			sum += expectedTask(level+1, id*NestedFanout+f)
+		}
+	}
+	return sum
+}
+
+func serveNestedRequests(id int, total *int, done chan bool, i *int) {
+	for i = new(int); *i < NestedRequests; *i++ {
+		latencyStart := time.Now()
+		*total += runTask(0, id*NestedRequests+*i).value
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+	}
+	done <- true
+}
+
+func RunNestedRegions() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// To avoid escape analysis
+	c := make([]int, Goroutines)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	done := make(chan bool)
+	totals := make([]int, Goroutines)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < Goroutines; i++ {
+		go serveNestedRequests(i, &totals[i], done, &c[i])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		for i := range totals {
+			expected := 0
+			for n := 0; n < NestedRequests; n++ {
+				expected += expectedTask(0, i*NestedRequests+n)
+			}
+			if totals[i] != expected {
+				Fail("nested-regions: requests of goroutine %d summed to %d, expected %d", i, totals[i], expected)
+				break
+			}
+		}
+		verification = time.Since(verificationStart)
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(NestedRequests*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
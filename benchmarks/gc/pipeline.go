@@ -0,0 +1,143 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A batch of records travels through the stages of the pipeline.
+type batch struct {
+	records      []*record
+	latencyStart time.Time
+}
+
+// A record is allocated anew by every stage, from the record of the stage before.
+type record struct {
+	raw    [64]byte
+	fields [8]int
+}
+
+// parse is the first stage. It reads PipelineOp raw records, parses their fields
+// and sends them on in batches of PipelineBatch.
+func parse(id int, out chan *batch, done chan bool, i *int) {
+	for i = new(int); *i < PipelineOp; *i += PipelineBatch {
+		allocationStart := time.Now()
+		b := new(batch)
+		b.records = make([]*record, min(PipelineBatch, PipelineOp-*i))
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		b.latencyStart = time.Now()
+		for j := range b.records {
+			allocationStart = time.Now()
+			rec := new(record)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+			for k := range rec.raw {
+				rec.raw[k] = byte(id + *i + j + k)
+			}
+			for k := range rec.raw {
+				rec.fields[k/8] += int(rec.raw[k])
+			}
+			b.records[j] = rec
+		}
+		out <- b
+	}
+	done <- true
+}
+
+// transform is a middle stage, it replaces every record of a batch by a new one.
+func transform(stage int, in chan *batch, out chan *batch, done chan bool) {
+	for b := range in {
+		for j, prev := range b.records {
+			allocationStart := time.Now()
+			rec := new(record)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+			rec.raw = prev.raw
+			for k := range rec.fields {
+				rec.fields[k] = prev.fields[k]*stage + k
+			}
+			b.records[j] = rec
+		}
+		out <- b
+	}
+	done <- true
+}
+
+// aggregate is the last stage, it sums the fields of the records and drops the batches.
+func aggregate(in chan *batch, done chan bool, sum *int) {
+	for b := range in {
+		for _, rec := range b.records {
+			for _, f := range rec.fields {
+				*sum += f
+			}
+		}
+		Latency.Add(time.Since(b.latencyStart).Nanoseconds())
+	}
+	done <- true
+}
+
+// closeStage closes the output of a stage once its goroutines are done.
+func closeStage(out chan *batch, done chan bool) {
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+	close(out)
+}
+
+func RunPipeline() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// To avoid escape analysis
+	c := make([]int, Goroutines)
+	sums := make([]int, Goroutines)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	// links[s] connects stage s to stage s+1
+	links := make([]chan *batch, PipelineStages-1)
+	dones := make([]chan bool, PipelineStages-1)
+	for s := range links {
+		links[s] = make(chan *batch, Goroutines)
+		dones[s] = make(chan bool)
+	}
+	done := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	last := PipelineStages - 1
+	for i := 0; i < Goroutines; i++ {
+		go parse(i, links[0], dones[0], &c[i])
+		for s := 1; s < last; s++ {
+			go transform(s, links[s-1], links[s], dones[s])
+		}
+		go aggregate(links[last-1], done, &sums[i])
+	}
+	for s := range links {
+		go closeStage(links[s], dones[s])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(PipelineOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
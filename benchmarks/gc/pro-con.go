@@ -34,15 +34,15 @@ func consuming(buffer chan value, done chan bool) {
 }
 
 func RunProducerConsumer(valueRange int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
 	DeallocationTime.Store(0)
 	Latency.Store(0)
 
-	x := [Goroutines]value{} // To avoid escape analysis to the stack
-	c := [Goroutines]int{}
+	x := make([]value, Goroutines) // To avoid escape analysis to the stack
+	c := make([]int, Goroutines)
 
 	computationTimeStart := time.Now()
 
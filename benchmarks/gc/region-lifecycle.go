@@ -0,0 +1,85 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// lifecycleObjects are linked into a list, so every scope holds a pointer graph.
+type lifecycleObject struct {
+	next *lifecycleObject
+	buf  [56]byte
+}
+
+// fillScope allocates n objects, which are garbage once the scope ends.
+func fillScope(n int) *lifecycleObject {
+	var head *lifecycleObject
+	for i := 0; i < n; i++ {
+		allocationStart := time.Now()
+		o := new(lifecycleObject)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		o.next = head
+		head = o
+	}
+	return head
+}
+
+func shareScope(n int, heads []*lifecycleObject, done chan bool) {
+	heads[0] = fillScope(n)
+	done <- true
+}
+
+// RunRegionLifecycle allocates the objects the regions of the RBMM variant hold
+// on the heap instead: depth nested scopes LifecycleCycles times, the outermost
+// one filled by Goroutines goroutines. size only applies to regions.
+func RunRegionLifecycle(size int, objects int, depth int) SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	// To avoid escape analysis
+	heads := make([]*lifecycleObject, depth+Goroutines)
+	done := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for c := 0; c < LifecycleCycles; c++ {
+		latencyStart := time.Now()
+
+		for g := 0; g < Goroutines; g++ {
+			go shareScope(objects, heads[depth+g:], done)
+		}
+		for d := 1; d < depth; d++ {
+			heads[d] = fillScope(objects)
+		}
+		for g := 0; g < Goroutines; g++ {
+			<-done
+		}
+
+		// Ending the scopes leaves their objects to the GC
+		clear(heads)
+
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(LifecycleCycles*depth) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
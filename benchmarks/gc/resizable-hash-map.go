@@ -0,0 +1,206 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A table is one generation of the buckets of a ResizableMap. It is left to the
+// GC once the next generation has taken over the values.
+type table struct {
+	buckets    []*bucket
+	size       int
+	generation int
+}
+
+// A ResizableMap starts with HashInitCap buckets and doubles them whenever the
+// map holds more than HashLoadFactor values per bucket. Every request holds the
+// read lock of mu until it is answered and growing holds the write lock: a
+// bucket goroutine cannot hand a request on to the next generation, so the
+// table may only be swapped once no request is in flight. Growth therefore
+// stops the whole map, unlike the lock-free requests of hash-map.
+type ResizableMap struct {
+	mu    sync.RWMutex
+	table *table
+	count atomic.Int64
+}
+
+func newTable(size int, generation int) *table {
+	allocationTimeStart := time.Now()
+	t := new(table)
+	t.buckets = make([]*bucket, size)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	t.size = size
+	t.generation = generation
+
+	for i := 0; i < size; i++ {
+		allocationTimeStart = time.Now()
+		t.buckets[i] = new(bucket)
+		t.buckets[i].store = new(list)
+		t.buckets[i].requests = make(chan request)
+		t.buckets[i].done = make(chan bool)
+		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+	}
+	return t
+}
+
+// start runs the goroutines of the buckets of t.
+func (t *table) start() {
+	for i := 0; i < t.size; i++ {
+		req := request{}
+		go t.buckets[i].run(&req)
+	}
+}
+
+// retire stops the goroutines of the buckets of t.
+func (t *table) retire() {
+	for i := 0; i < t.size; i++ {
+		close(t.buckets[i].requests)
+		<-t.buckets[i].done
+	}
+}
+
+func NewResizableMap() *ResizableMap {
+	allocationTimeStart := time.Now()
+	m := new(ResizableMap)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	m.table = newTable(HashInitCap, 0)
+	m.table.start()
+	return m
+}
+
+// grow doubles the buckets of generation, unless another goroutine already did.
+// The values are rehashed into the buckets of the next generation before its
+// goroutines start, so no request can see a half migrated table.
+func (m *ResizableMap) grow(generation int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.table
+	if old.generation != generation || m.count.Load() <= int64(old.size*HashLoadFactor) {
+		return
+	}
+
+	t := newTable(old.size*2, generation+1)
+	for i := 0; i < old.size; i++ {
+		for e := old.buckets[i].store; e != nil && e.value != 0; e = e.next {
+			t.buckets[e.value%t.size].add(e.value)
+		}
+	}
+	t.start()
+
+	m.table = t
+	old.retire()
+}
+
+// send hands a request to the bucket of its value and returns the result
+// together with the generation and size of the table that handled it.
+func (m *ResizableMap) send(req request) (bool, int, int) {
+	m.mu.RLock()
+	t := m.table
+	t.buckets[req.value%t.size].requests <- req
+	ok := <-req.result
+	m.mu.RUnlock()
+
+	return ok, t.generation, t.size
+}
+
+func (m *ResizableMap) Insert(value int, res chan bool, req request) bool {
+	req.value = value
+	req.op = OpInsert
+	req.result = res
+	req.latencyStart = time.Now()
+
+	ok, generation, size := m.send(req)
+	if ok && m.count.Add(1) > int64(size*HashLoadFactor) {
+		m.grow(generation)
+	}
+	return ok
+}
+
+func (m *ResizableMap) Search(value int, res chan bool) bool {
+	ok, _, _ := m.send(request{value: value, op: OpSearch, result: res, latencyStart: time.Now()})
+	return ok
+}
+
+func (m *ResizableMap) Delete(value int, res chan bool) bool {
+	ok, _, _ := m.send(request{value: value, op: OpRemove, result: res, latencyStart: time.Now()})
+	if ok {
+		m.count.Add(-1)
+	}
+	return ok
+}
+
+func generateResizableHashMapOperations(id int, m *ResizableMap, valueRange int, op int, done chan bool, i *int) {
+	allocationTimeStart := time.Now()
+	res := make(chan bool)
+	req := new(request)
+	i = new(int)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id)))
+	keys := new(KeyGenerator)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	keys.Init(HashKeys, valueRange, HashRange*Goroutines, rng)
+
+	for *i = 0; *i < op; *i++ {
+		switch opType(HashMix.Pick(rng)) {
+		case OpInsert:
+			m.Insert(keys.Insert(), res, *req)
+		case OpSearch:
+			m.Search(keys.Existing(), res)
+		case OpRemove:
+			m.Delete(keys.Existing(), res)
+		}
+	}
+	done <- true
+}
+
+func RunResizableHashMap() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+
+	allocationTimeStart := time.Now()
+	done := make(chan bool)
+	c := make([]int, Goroutines)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	m := NewResizableMap()
+
+	valueRange := 0
+	for i := 0; i < Goroutines; i++ {
+		go generateResizableHashMapOperations(i, m, valueRange, HashOp, done, &c[i])
+		valueRange += HashOp
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	m.table.retire()
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(HashOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
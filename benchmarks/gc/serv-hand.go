@@ -1,39 +1,61 @@
 package gc
 
 import (
+	"encoding/binary"
 	. "experiments/benchmarks/metrics"
 	"fmt"
+	"io"
 	"net"
 	"runtime"
 	"runtime/debug"
+	"sync"
 	"time"
 )
 
 type Request struct {
 	conn         net.Conn
 	latencyStart time.Time
-	buf          [1024]byte
+	header       [4]byte
+	buf          [ServHandMaxPayload]byte
+}
+
+// A Response is allocated by the server for every request it reads.
+type Response struct {
+	header [4]byte
+	// Checksum of the payload followed by the payload
+	buf [4 + ServHandMaxPayload]byte
 }
 
 type server struct {
 	requests chan Request
 	listener net.Listener
+	closed   sync.Once
+	closeErr error
 }
 
-func newServer(address string) (*server, error) {
+// newServer listens on network, see Listen.
+func newServer(network string) (*server, error) {
 	allocationTimeStart := time.Now()
 	s := new(server)
 	s.requests = make(chan Request)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
-	s.listener, _ = net.Listen("tcp", address)
+	var err error
+	if s.listener, err = Listen(network); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
 
+// connections returns the amount of connections a client opens to send op requests.
+func connections(op int) int {
+	return (op + ServHandKeepAlive - 1) / ServHandKeepAlive
+}
+
 func (s *server) acceptConnections(done chan bool, req *Request) {
 	var i *int
-	for i = new(int); *i < ServHandOp*Goroutines; *i++ {
+	for i = new(int); *i < connections(ServHandOp)*Goroutines; *i++ {
 		allocationTimeStart := time.Now()
 		req = new(Request)
 		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
@@ -45,7 +67,6 @@ func (s *server) acceptConnections(done chan bool, req *Request) {
 		}
 
 		req.conn = conn
-		req.latencyStart = time.Now()
 		s.requests <- *req
 	}
 	close(s.requests)
@@ -58,13 +79,34 @@ func (s *server) handleConnections(done chan bool, req *Request) {
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
 	for *req = range s.requests {
-		Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 		s.handleConnection(req)
 	}
 	done <- true
 }
 
+// handleConnection answers the requests of a connection until the client closes it.
 func (s *server) handleConnection(req *Request) {
+	for {
+		n, err := ReadMessage(req.conn, &req.header, req.buf[:])
+		if err != nil {
+			if err != io.EOF {
+				Fail("serv-hand: %v", err)
+			}
+			break
+		}
+
+		allocationTimeStart := time.Now()
+		resp := new(Response)
+		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+		binary.BigEndian.PutUint32(resp.buf[:4], Checksum(req.buf[:n]))
+		copy(resp.buf[4:], req.buf[:n])
+
+		if err := WriteMessage(req.conn, &resp.header, resp.buf[:4+n]); err != nil {
+			Fail("serv-hand: %v", err)
+			break
+		}
+	}
 	req.conn.Close()
 }
 
@@ -73,30 +115,85 @@ var handReq Request
 
 func (s *server) run(done chan bool) {
 	go s.acceptConnections(done, &accReq)
-	go s.handleConnections(done, &handReq)
+	// A handler per client, so that connections are served concurrently
+	for i := 0; i < Goroutines; i++ {
+		go s.handleConnections(done, &handReq)
+	}
 }
 
 func (s *server) stop(done chan bool) error {
 	<-done // acceptConnections
-	<-done // handleConnections
-	return s.listener.Close()
+	for i := 0; i < Goroutines; i++ {
+		<-done // handleConnections
+	}
+	return s.close()
 }
 
-func sendRequests(op int, done chan bool, address string, i *int, req *Request) {
+// close closes the listener once, Accept fails from then on.
+func (s *server) close() error {
+	s.closed.Do(func() { s.closeErr = s.listener.Close() })
+	return s.closeErr
+}
+
+// abort fails the run of a client that cannot send its requests. The server
+// would wait for connections that are never opened, so its listener is closed.
+func (s *server) abort(err error) {
+	Fail("serv-hand: %v", err)
+	s.close()
+}
+
+// sendRequests sends op requests of ServHandPayload bytes, ServHandKeepAlive
+// on each connection to s, and checks the responses of the server.
+func sendRequests(op int, done chan bool, s *server, i *int, req *Request) {
+	allocationTimeStart := time.Now()
+	resp := new(Response)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
 	for i = new(int); *i < op; *i++ {
-		allocationTimeStart := time.Now()
-		req = new(Request)
-		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+		if *i%ServHandKeepAlive == 0 {
+			if req.conn != nil {
+				req.conn.Close()
+			}
+
+			allocationTimeStart = time.Now()
+			req = new(Request)
+			AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+			var err error
+			if req.conn, err = Dial(s.listener.Addr()); err != nil {
+				s.abort(err)
+				break
+			}
+		}
+
+		for j := 0; j < ServHandPayload; j++ {
+			req.buf[j] = byte(*i + j)
+		}
 
-		req.conn, _ = net.Dial("tcp", address)
+		req.latencyStart = time.Now()
+		if err := WriteMessage(req.conn, &req.header, req.buf[:ServHandPayload]); err != nil {
+			s.abort(err)
+			break
+		}
+		n, err := ReadMessage(req.conn, &resp.header, resp.buf[:])
+		if err != nil {
+			s.abort(err)
+			break
+		}
+		Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 
+		if n != 4+ServHandPayload || binary.BigEndian.Uint32(resp.buf[:4]) != Checksum(req.buf[:ServHandPayload]) {
+			Fail("serv-hand: response of %d bytes to request %d does not match its payload", n, *i)
+		}
+	}
+	if req.conn != nil {
 		req.conn.Close()
 	}
 	done <- true
 }
 
 func RunServerHandler() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -104,27 +201,25 @@ func RunServerHandler() SystemMetrics {
 	Latency.Store(0)
 
 	// Bypassing escaping
-	c := [Goroutines]int{}
-	conn := [Goroutines]Request{}
+	c := make([]int, Goroutines)
+	conn := make([]Request, Goroutines)
 
 	computationTimeStart := time.Now()
 
 	allocationTimeStart := time.Now()
-	address := new(string)
 	done := make(chan bool)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
-	*address = ":8080"
 
-	s, err := newServer(*address)
+	s, err := newServer(ServHandNetwork)
 	if err != nil {
-		fmt.Println(err)
+		Fail("serv-hand: %v", err)
 		return SystemMetrics{}
 	}
 
 	s.run(done)
 
 	for i := 0; i < Goroutines; i++ {
-		go sendRequests(ServHandOp, done, *address, &c[i], &conn[i])
+		go sendRequests(ServHandOp, done, s, &c[i], &conn[i])
 	}
 
 	for i := 0; i < Goroutines; i++ {
@@ -0,0 +1,160 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+var (
+	logLevels = []string{"debug", "info", "warn", "error"}
+	logWords  = []string{"request", "served", "user", "cache", "miss", "retry", "connection", "closed", "timeout", "ok", "session", "expired"}
+)
+
+// A byteBuffer doubles its capacity when it runs out of room, the backing array
+// it outgrew is garbage afterwards.
+type byteBuffer struct {
+	buf []byte
+}
+
+func (b *byteBuffer) grow(n int) {
+	if len(b.buf)+n <= cap(b.buf) {
+		return
+	}
+	allocationStart := time.Now()
+	buf := make([]byte, len(b.buf), max(2*cap(b.buf), len(b.buf)+n, 16))
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	copy(buf, b.buf)
+	b.buf = buf
+}
+
+func (b *byteBuffer) write(p []byte) {
+	b.grow(len(p))
+	b.buf = append(b.buf, p...)
+}
+
+func (b *byteBuffer) writeString(s string) {
+	b.grow(len(s))
+	b.buf = append(b.buf, s...)
+}
+
+func (b *byteBuffer) writeInt(x int) {
+	b.grow(20)
+	b.buf = strconv.AppendInt(b.buf, int64(x), 10)
+}
+
+// renderLine formats a log line of up to StringFields key=value fields into a
+// new buffer.
+func renderLine(n int, rng *rand.Rand) *byteBuffer {
+	allocationStart := time.Now()
+	line := new(byteBuffer)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	line.writeString("ts=")
+	line.writeInt(n)
+	line.writeString(" level=")
+	line.writeString(logLevels[rng.IntN(len(logLevels))])
+	line.writeString(" msg=\"")
+	for w := rng.IntN(8); w >= 0; w-- {
+		line.writeString(logWords[rng.IntN(len(logWords))])
+		if w > 0 {
+			line.writeString(" ")
+		}
+	}
+	line.writeString("\"")
+	for f := 1 + rng.IntN(StringFields); f > 0; f-- {
+		line.writeString(" ")
+		line.writeString(logWords[rng.IntN(len(logWords))])
+		line.writeString("=")
+		line.writeInt(rng.IntN(1 << 20))
+	}
+	line.writeString("\n")
+	return line
+}
+
+// checkLog fails the run unless log holds lines lines of length bytes in total.
+func checkLog(log *byteBuffer, lines int, length int) {
+	newlines := 0
+	for _, c := range log.buf {
+		if c == '\n' {
+			newlines++
+		}
+	}
+	if newlines != lines || len(log.buf) != length {
+		Fail("string-builder: log has %d lines of %d bytes, expected %d lines of %d", newlines, len(log.buf), lines, length)
+	}
+}
+
+func generateLogLines(id int, done chan bool, i *int) {
+	allocationStart := time.Now()
+	i = new(int)
+	rng := rand.New(rand.NewPCG(Seed, uint64(id)))
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	var log *byteBuffer
+	lines, length := 0, 0
+	for *i = 0; *i < StringOp; *i++ {
+		// Flushing the log drops it
+		if *i%StringFlush == 0 {
+			allocationStart = time.Now()
+			log = new(byteBuffer)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+			lines, length = 0, 0
+		}
+
+		latencyStart := time.Now()
+		line := renderLine(*i, rng)
+		log.write(line.buf)
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		lines++
+		length += len(line.buf)
+		if Verify && ((*i+1)%StringFlush == 0 || *i+1 == StringOp) {
+			checkLog(log, lines, length)
+		}
+	}
+	done <- true
+}
+
+func RunStringBuilder() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// To avoid escape analysis
+	c := make([]int, Goroutines)
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	done := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < Goroutines; i++ {
+		go generateLogLines(i, done, &c[i])
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(StringOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,113 @@
+package gc
+
+import (
+	. "experiments/benchmarks/metrics"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A job is fanned out by the dispatcher to one of the workers.
+type job struct {
+	id           int
+	latencyStart time.Time
+}
+
+// A jobResult is fanned back in from the workers to the merger.
+type jobResult struct {
+	sum          int
+	latencyStart time.Time
+}
+
+// dispatch fans WorkerPoolJobs jobs per worker out to the pool.
+func dispatch(jobs chan job, i *int) {
+	for i = new(int); *i < WorkerPoolJobs*Goroutines; *i++ {
+		jobs <- job{id: *i, latencyStart: time.Now()}
+	}
+	close(jobs)
+}
+
+// work runs the jobs it receives, every job fills and sums its own scratch slice,
+// which is garbage as soon as the job is done.
+func work(jobs chan job, results chan jobResult, done chan bool) {
+	for j := range jobs {
+		allocationStart := time.Now()
+		scratch := make([]int, WorkerPoolScratch)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		for k := range scratch {
+			scratch[k] = j.id + k
+		}
+		sum := 0
+		for _, x := range scratch {
+			sum += x
+		}
+		results <- jobResult{sum: sum, latencyStart: j.latencyStart}
+	}
+	done <- true
+}
+
+// merge fans the results of the workers in and sums them.
+func merge(results chan jobResult, done chan bool, total *int) {
+	for res := range results {
+		*total += res.sum
+		Latency.Add(time.Since(res.latencyStart).Nanoseconds())
+	}
+	done <- true
+}
+
+// expectedTotal is the sum of the results of all jobs.
+func expectedTotal() int {
+	jobs, n := WorkerPoolJobs*Goroutines, WorkerPoolScratch
+	return n*jobs*(jobs-1)/2 + jobs*n*(n-1)/2
+}
+
+func RunWorkerPool() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	// To avoid escape analysis
+	var i, total int
+
+	computationTimeStart := time.Now()
+
+	allocationStart := time.Now()
+	jobs := make(chan job, Goroutines)
+	results := make(chan jobResult, Goroutines)
+	doneWorkers := make(chan bool)
+	doneMerge := make(chan bool)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	go dispatch(jobs, &i)
+	for w := 0; w < Goroutines; w++ {
+		go work(jobs, results, doneWorkers)
+	}
+	go merge(results, doneMerge, &total)
+
+	for w := 0; w < Goroutines; w++ {
+		<-doneWorkers
+	}
+	close(results)
+	<-doneMerge
+
+	deallocationStart := time.Now()
+	runtime.GC()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	if Verify && total != expectedTotal() {
+		Fail("worker-pool: merged %d, expected %d", total, expectedTotal())
+	}
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(WorkerPoolJobs*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,139 @@
+//go:build goexperiment.regions
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// A job is sent by the supervisor to a child process on its stdin.
+type job struct {
+	Config     configuration
+	Experiment experiment
+	Rounds     int
+}
+
+// A result is the outcome of a job, reported by a child process as JSON on its stdout.
+type result struct {
+	Rounds   []SystemMetrics
+	Memory   []MemoryMetrics
+	Failures []failure
+	// Counts of the buckets of every one of Histograms over all rounds
+	Latencies [][]int64
+}
+
+// addCounts adds the bucket counts of src to dst.
+func addCounts(dst []int64, src []int64) []int64 {
+	if dst == nil {
+		dst = make([]int64, len(src))
+	}
+	for i := range src {
+		dst[i] += src[i]
+	}
+	return dst
+}
+
+// merge appends the rounds and memory samples of r, whose first round is round
+// first of the configuration, to res. The time stamps of r are shifted so that
+// the samples of consecutive children form one timeline.
+func (res *result) merge(r result, first int) {
+	var offset float64
+	if len(res.Memory) > 0 {
+		offset = res.Memory[len(res.Memory)-1].TimeStamp
+	}
+	for _, m := range r.Memory {
+		m.TimeStamp += offset
+		res.Memory = append(res.Memory, m)
+	}
+	for _, f := range r.Failures {
+		if f.Round >= 0 {
+			f.Round += first
+		}
+		res.Failures = append(res.Failures, f)
+	}
+	res.Rounds = append(res.Rounds, r.Rounds...)
+	res.addLatencies(r.Latencies)
+}
+
+// addLatencies adds the bucket counts of every one of Histograms to res.
+func (res *result) addLatencies(latencies [][]int64) {
+	if res.Latencies == nil {
+		res.Latencies = make([][]int64, len(Histograms))
+	}
+	for i := range latencies {
+		res.Latencies[i] = addCounts(res.Latencies[i], latencies[i])
+	}
+}
+
+// runChild re-executes this binary to run a job in a fresh process, so that heap
+// state, leftover goroutines and GC settings of one measurement cannot leak into
+// the next. The child's stderr is passed through and, if the child fails, saved
+// next to the results of the configuration.
+func runChild(c configuration, rounds int) (result, error) {
+	var res result
+
+	exe, err := os.Executable()
+	if err != nil {
+		return res, err
+	}
+	in, err := json.Marshal(job{c, exp, rounds})
+	if err != nil {
+		return res, err
+	}
+
+	ctx := context.Background()
+	if exp.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(exp.Timeout))
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe, "-child")
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("child killed after %v", time.Duration(exp.Timeout))
+	}
+	if err == nil {
+		err = json.Unmarshal(stdout.Bytes(), &res)
+	}
+	if err != nil {
+		crash := c.path("crash.log")
+		os.WriteFile(crash, stderr.Bytes(), 0600)
+		return result{}, fmt.Errorf("%v, stderr saved to %s", err, crash)
+	}
+	return res, nil
+}
+
+// runAsChild runs the job read from stdin and writes its result to stdout.
+// Anything the workloads print is redirected to stderr to keep stdout for the result.
+func runAsChild() error {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	var j job
+	if err := json.NewDecoder(os.Stdin).Decode(&j); err != nil {
+		return err
+	}
+	if j.Rounds < 1 {
+		return errors.New("job has no rounds")
+	}
+
+	exp = j.Experiment
+	exp.Workload.apply()
+
+	return json.NewEncoder(out).Encode(measure(j.Config, exp.WarmUp, j.Rounds))
+}
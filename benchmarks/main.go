@@ -7,7 +7,10 @@ import (
 	"experiments/benchmarks/gc"
 	. "experiments/benchmarks/metrics"
 	"experiments/benchmarks/region"
+	"flag"
+	"fmt"
 	"math"
+	"math/rand/v2"
 	"os"
 	"runtime"
 	"strconv"
@@ -20,93 +23,333 @@ type MemoryManager int
 var stop atomic.Bool
 
 const (
-	GC      = MemoryManager(iota)
-	RBMM    = MemoryManager(iota)
-	WarmUp  = 5
-	Rounds  = 10
-	Range   = 100
-	Program = "serv-hand"
+	GC   = MemoryManager(iota)
+	RBMM = MemoryManager(iota)
 )
 
+// The experiment being run, see loadExperiment
+var exp experiment
+
+var (
+	experimentFile = flag.String("experiment", "", "JSON file describing the experiment, flags given as well override it")
+	programs       = flag.String("programs", "serv-hand", "comma-separated list of programs to run")
+	managers       = flag.String("managers", "GC", "comma-separated list of memory managers to run (GC, RBMM)")
+	goroutines     = flag.String("goroutines", "256", "goroutine counts to run, as a list (1,16,32) or a geometric range (1:256:2)")
+	warmUp         = flag.Int("warmup", 5, "warm-up runs before the measured rounds of a configuration")
+	rounds         = flag.Int("rounds", 10, "measured rounds of a configuration")
+	shuffle        = flag.Bool("shuffle", false, "run the configurations in a random order")
+	seed           = flag.Uint64("seed", 0, "seed used to shuffle the configurations, 0 picks a random seed")
+	workloadSeed   = flag.Uint64("workload-seed", Seed, "seed of the random number generators of the workloads")
+	results        = flag.String("results", "results", "directory the results are written to")
+	appendSys      = flag.Bool("append", false, "append to the <MM>-sys.csv summaries instead of starting new ones")
+	isolate        = flag.String("isolate", "none", "run each configuration or round in a child process (none, config, round)")
+	timeout        = flag.Duration("timeout", 0, "time after which a child process is killed, 0 means no limit")
+	deadline       = flag.Duration("deadline", 0, "time after which a single run is considered hung and fails, 0 means no limit")
+	resume         = flag.Bool("resume", false, "skip the configurations a previous run of this sweep completed, see manifest.json")
+	child          = flag.Bool("child", false, "run a single job read from stdin and report its result on stdout (used by -isolate)")
+)
+
+func (mm MemoryManager) String() string {
+	switch mm {
+	case GC:
+		return "GC"
+	case RBMM:
+		return "RBMM"
+	}
+	return "MemoryManager(" + strconv.Itoa(int(mm)) + ")"
+}
+
 func main() {
-	mm := MemoryManager(GC)
-	var sysMetrics [Rounds]SystemMetrics
-	done := make(chan bool)
+	flag.Parse()
 
-	for i := 0; i < WarmUp; i++ {
-		runTests(mm)
+	if *child {
+		if err := runAsChild(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	var err error
+	if exp, err = loadExperiment(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	exp.Workload.apply()
+	configs := newSweep(exp)
+
+	id, err := buildID()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	m := &manifest{BuildID: id}
+	if *resume {
+		if m, err = loadManifest(configs, id); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if exp.Seed == 0 {
+			exp.Seed = m.Seed
+		}
+	}
+
+	if exp.Shuffle {
+		if exp.Seed == 0 {
+			exp.Seed = rand.Uint64()
+		}
+		fmt.Println("Shuffling configurations with seed", exp.Seed)
+		shuffleSweep(configs, exp.Seed)
+		m.Seed = exp.Seed
+	}
+
+	if err := prepareResults(configs, *appendSys || *resume); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := m.save(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := saveExperiment(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for i, c := range configs {
+		if m.completed(c) {
+			fmt.Printf("[%d/%d] %s already completed\n", i+1, len(configs), c)
+			continue
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(configs), c)
+		if !run(c) {
+			continue
+		}
+		if err := m.complete(c); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// run measures a configuration and writes its results. It reports whether all rounds succeeded.
+func run(c configuration) bool {
+	var res result
+	var err error
+	switch exp.Isolate {
+	case "none":
+		res = measure(c, exp.WarmUp, exp.Rounds)
+	case "config":
+		res, err = runChild(c, exp.Rounds)
+	case "round":
+		for i := 0; i < exp.Rounds; i++ {
+			var round result
+			round, err = runChild(c, 1)
+			if err != nil {
+				break
+			}
+			res.merge(round, i)
+			if round.hung() {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c, err)
+	}
+	if len(res.Failures) > 0 {
+		writeFailures(res.Failures, c)
+	} else {
+		os.Remove(c.path("failures.csv"))
+		os.Remove(c.path("stacks.txt"))
+	}
+	if len(res.Rounds) == 0 {
+		return false
+	}
+
+	writeSys(res.Rounds, c)
+	writeMem(res.Memory, c)
+	writeLatencies(res, c)
+
+	// The summary row is appended, only a completed configuration writes it
+	// so that -resume does not add a second row for the same configuration
+	complete := err == nil && len(res.Failures) == 0
+	if complete {
+		avgSysMetrics := averageSysMetrics(res.Rounds)
+		stdErrSysMetrics := stdErr(avgSysMetrics, res.Rounds, float64(len(res.Rounds)))
+		writeSysStats(avgSysMetrics, stdErrSysMetrics, c)
+	}
+	return complete
+}
+
+// measure runs the warm-up and measured rounds of a configuration in this process.
+// A run that hangs ends the configuration with a failure, see runWithWatchdog,
+// while a run with a wrong result only fails its own round.
+func measure(c configuration, warmUp int, rounds int) result {
+	SetGoroutines(c.Goroutines)
+
+	var res result
+	samples := make(chan []MemoryMetrics)
+
+	for i := 0; i < warmUp; i++ {
+		if _, f := runWithWatchdog(c); f != nil {
+			f.Round = -1
+			res.Failures = append(res.Failures, *f)
+			return res
+		}
+		if err := Failed(); err != nil {
+			res.Failures = append(res.Failures, failure{Round: -1, Reason: err.Error()})
+		}
 	}
 
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 	stop.Store(false)
-	go measureAllMemStats(mm, done, memStats)
-	for i := 0; i < Rounds; i++ {
-		sysMetrics[i] = runTests(mm)
+	go measureAllMemStats(c, samples, memStats)
+	for i := 0; i < rounds; i++ {
+		for _, h := range Histograms {
+			h.Histogram.Reset()
+		}
+		m, f := runWithWatchdog(c)
+		if f != nil {
+			f.Round = i
+			res.Failures = append(res.Failures, *f)
+			break
+		}
+		// A wrong result fails the round, but does not harm the next one
+		if err := Failed(); err != nil {
+			res.Failures = append(res.Failures, failure{Round: i, Reason: err.Error()})
+			continue
+		}
+		res.Rounds = append(res.Rounds, m)
+		latencies := make([][]int64, len(Histograms))
+		for i, h := range Histograms {
+			latencies[i] = h.Histogram.Counts()
+		}
+		res.addLatencies(latencies)
 	}
 	stop.Store(true)
 
-	avgSysMetrics := averageSysMetrics(sysMetrics)
-	stdErrSysMetrics := stdErr(avgSysMetrics, sysMetrics, float64(Rounds))
-
-	writeSysStats(avgSysMetrics, stdErrSysMetrics, mm)
-	writeSys(sysMetrics, mm)
-	<-done
+	res.Memory = <-samples
+	return res
 }
 
-func runTests(mm MemoryManager) SystemMetrics {
+func runTests(program string, mm MemoryManager) SystemMetrics {
 	var m SystemMetrics
 	switch mm {
 	case GC:
-		switch Program {
+		switch program {
 		case "mat-mul":
-			m = gc.RunMatrixMultiplication(Range)
+			m = gc.RunMatrixMultiplication(exp.Workload.Range)
 		case "bin-tree":
 			m = gc.RunBinaryTree(BinOp)
+		case "avl-tree":
+			m = gc.RunAVLTree(BinOp)
 		case "pro-con":
-			m = gc.RunProducerConsumer(Range)
+			m = gc.RunProducerConsumer(exp.Workload.Range)
 		case "serv-hand":
 			m = gc.RunServerHandler()
+		case "http":
+			m = gc.RunHTTPServer()
+		case "pipeline":
+			m = gc.RunPipeline()
+		case "worker-pool":
+			m = gc.RunWorkerPool()
+		case "lru-cache":
+			m = gc.RunLRUCache()
+		case "graph":
+			m = gc.RunGraph()
+		case "json":
+			m = gc.RunJSON()
+		case "string-builder":
+			m = gc.RunStringBuilder()
+		case "nested-regions":
+			m = gc.RunNestedRegions()
 		case "hash-map":
 			m = gc.RunHashMap()
+		case "hash-map-resize":
+			m = gc.RunResizableHashMap()
+		case "alloc":
+			m = gc.RunAlloc()
+		case "channel":
+			m = gc.RunChannel()
 		default:
-			panic("unreachable")
+			if buffer, payload, senders, receivers, ok := parseChannelMatrix(program); ok {
+				m = gc.RunChannelMatrix(buffer, payload, senders, receivers)
+				break
+			}
+			if size, objects, depth, ok := parseLifecycle(program); ok {
+				m = gc.RunRegionLifecycle(size, objects, depth)
+				break
+			}
+			size, pointers, ok := parseAllocSweep(program)
+			if !ok {
+				panic("unreachable")
+			}
+			m = gc.RunAllocSweep(size, pointers)
 		}
 	case RBMM:
-		switch Program {
+		switch program {
 		case "mat-mul":
-			m = region.RunMatrixMultiplication(Range)
+			m = region.RunMatrixMultiplication(exp.Workload.Range)
 		case "bin-tree":
 			m = region.RunBinaryTree(BinOp)
+		case "avl-tree":
+			m = region.RunAVLTree(BinOp)
 		case "pro-con":
-			m = region.RunProducerConsumer(Range)
+			m = region.RunProducerConsumer(exp.Workload.Range)
 		case "serv-hand":
 			m = region.RunServerHandler()
+		case "http":
+			m = region.RunHTTPServer()
+		case "pipeline":
+			m = region.RunPipeline()
+		case "worker-pool":
+			m = region.RunWorkerPool()
+		case "lru-cache":
+			m = region.RunLRUCache()
+		case "graph":
+			m = region.RunGraph()
+		case "json":
+			m = region.RunJSON()
+		case "string-builder":
+			m = region.RunStringBuilder()
+		case "nested-regions":
+			m = region.RunNestedRegions()
 		case "hash-map":
 			m = region.RunHashMap()
+		case "hash-map-resize":
+			m = region.RunResizableHashMap()
+		case "alloc":
+			m = region.RunAlloc()
+		case "channel":
+			m = region.RunChannel()
 		default:
-			panic("unreachable")
+			if buffer, payload, senders, receivers, ok := parseChannelMatrix(program); ok {
+				m = region.RunChannelMatrix(buffer, payload, senders, receivers)
+				break
+			}
+			if size, objects, depth, ok := parseLifecycle(program); ok {
+				m = region.RunRegionLifecycle(size, objects, depth)
+				break
+			}
+			size, pointers, ok := parseAllocSweep(program)
+			if !ok {
+				panic("unreachable")
+			}
+			m = region.RunAllocSweep(size, pointers)
 		}
 	}
 	return m
 }
 
-func writeSys(sysMetrics [Rounds]SystemMetrics, mm MemoryManager) {
-	var mmStr string
-	switch mm {
-	case GC:
-		mmStr = "GC"
-	case RBMM:
-		mmStr = "RBMM"
-	}
-
+func writeSys(sysMetrics []SystemMetrics, c configuration) {
 	var output [][]string
 	metricsHeader := []string{"G", "T_C", "T_L", "Theta", "T_A", "T_D"}
 	output = append(output, metricsHeader)
 
 	for _, m := range sysMetrics {
 		metricsData := []string{
-			strconv.Itoa(Goroutines),
+			strconv.Itoa(c.Goroutines),
 			strconv.FormatFloat(m.ComputationTime/1_000_000, 'f', 2, 64),
 			strconv.FormatFloat(m.Latency/1_000_000, 'f', 2, 64),
 			strconv.FormatFloat(m.Throughput*1_000_000, 'f', 2, 64),
@@ -116,26 +359,32 @@ func writeSys(sysMetrics [Rounds]SystemMetrics, mm MemoryManager) {
 		output = append(output, metricsData)
 	}
 
-	file, _ := os.OpenFile("results/"+Program+"/"+strconv.Itoa(Goroutines)+"-"+mmStr+"-sys.csv", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	file, _ := os.OpenFile(c.path("sys.csv"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	csvWriter := csv.NewWriter(file)
 	csvWriter.WriteAll(output)
 	file.Close()
 }
 
-func averageSysMetrics(m [Rounds]SystemMetrics) SystemMetrics {
+func averageSysMetrics(m []SystemMetrics) SystemMetrics {
 	var avg SystemMetrics
-	for i := 0; i < Rounds; i++ {
-		avg.ComputationTime += m[i].ComputationTime / Rounds
-		avg.AllocationTime += m[i].AllocationTime / Rounds
-		avg.DeallocationTime += m[i].DeallocationTime / Rounds
-		avg.Latency += m[i].Latency / Rounds
-		avg.Throughput += m[i].Throughput / Rounds
+	n := float64(len(m))
+	for i := range m {
+		avg.ComputationTime += m[i].ComputationTime / n
+		avg.AllocationTime += m[i].AllocationTime / n
+		avg.DeallocationTime += m[i].DeallocationTime / n
+		avg.Latency += m[i].Latency / n
+		avg.Throughput += m[i].Throughput / n
 	}
 
 	return avg
 }
 
-func stdErr(mean SystemMetrics, metrics [Rounds]SystemMetrics, n float64) SystemMetrics {
+// stdErr returns the standard error of the mean of metrics. A single round, from
+// -rounds 1 or after the others failed, has no spread to estimate and gets 0.
+func stdErr(mean SystemMetrics, metrics []SystemMetrics, n float64) SystemMetrics {
+	if n < 2 {
+		return SystemMetrics{}
+	}
 	var sumSq SystemMetrics
 	for _, m := range metrics {
 		sumSq.ComputationTime += math.Pow(m.ComputationTime-mean.ComputationTime, 2)
@@ -160,13 +409,11 @@ func stdErr(mean SystemMetrics, metrics [Rounds]SystemMetrics, n float64) System
 	}
 }
 
-func measureAllMemStats(mm MemoryManager, done chan bool, memStats runtime.MemStats) {
+func measureAllMemStats(c configuration, samples chan []MemoryMetrics, memStats runtime.MemStats) {
 	var memCons, extFrag, intFrag float64
 	var stamp, oldStamp int64
 
-	var data [][]string
-	header := []string{"Time", "M_C", "ExtFrag", "IntFrag"}
-	data = append(data, header)
+	var data []MemoryMetrics
 
 	memConsBefore := memStats.HeapAlloc
 	intFragBefore := memStats.HeapIntFrag
@@ -179,7 +426,7 @@ func measureAllMemStats(mm MemoryManager, done chan bool, memStats runtime.MemSt
 
 			extFrag = float64(memStats.HeapIdle) / float64(1024*1024)                // MB
 			memCons = float64(memStats.HeapAlloc-memConsBefore) / float64(1024*1024) // MB
-			switch mm {
+			switch c.MM {
 			case GC:
 				intFrag = float64(memStats.HeapIntFrag-intFragBefore) / float64(1024*1024)
 			case RBMM:
@@ -188,48 +435,48 @@ func measureAllMemStats(mm MemoryManager, done chan bool, memStats runtime.MemSt
 				}
 			}
 
-			data = append(data, []string{
-				strconv.Itoa(int(stamp)),
-				strconv.FormatFloat(memCons, 'f', 2, 64),
-				strconv.FormatFloat(extFrag, 'f', 2, 64),
-				strconv.FormatFloat(intFrag, 'f', 2, 64)})
+			data = append(data, MemoryMetrics{
+				TimeStamp:         float64(stamp),
+				MemoryConsumption: memCons,
+				ExternalFrag:      extFrag,
+				InternalFrag:      intFrag})
 		}
 		oldStamp = stamp
 	}
-	var mmStr string
-	switch mm {
-	case GC:
-		mmStr = "GC"
-	case RBMM:
-		mmStr = "RBMM"
+	samples <- data
+}
+
+func writeMem(memMetrics []MemoryMetrics, c configuration) {
+	var data [][]string
+	header := []string{"Time", "M_C", "ExtFrag", "IntFrag"}
+	data = append(data, header)
+
+	for _, m := range memMetrics {
+		data = append(data, []string{
+			strconv.Itoa(int(m.TimeStamp)),
+			strconv.FormatFloat(m.MemoryConsumption, 'f', 2, 64),
+			strconv.FormatFloat(m.ExternalFrag, 'f', 2, 64),
+			strconv.FormatFloat(m.InternalFrag, 'f', 2, 64)})
 	}
-	file, _ := os.OpenFile("results/"+Program+"/"+strconv.Itoa(Goroutines)+"-"+mmStr+"-mem.csv", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+	file, _ := os.OpenFile(c.path("mem.csv"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	csvWriter := csv.NewWriter(file)
 	csvWriter.WriteAll(data)
 	file.Close()
-	done <- true
 }
 
-func writeSysStats(avgMetrics SystemMetrics, stdErrMetrics SystemMetrics, mm MemoryManager) {
-	var mmStr string
-	switch mm {
-	case GC:
-		mmStr = "GC"
-	case RBMM:
-		mmStr = "RBMM"
-	}
-
+func writeSysStats(avgMetrics SystemMetrics, stdErrMetrics SystemMetrics, c configuration) {
 	var output [][]string
-	if _, err := os.Stat("results/" + Program + "/" + mmStr + "-sys.csv"); os.IsNotExist(err) {
+	if _, err := os.Stat(c.summaryPath()); os.IsNotExist(err) {
 		metricsHeader := []string{"G", "T_C", "T_L", "Theta", "T_A", "T_D", "T_C_ERR", "T_L_ERR", "Theta_ERR", "T_A_ERR", "T_D_ERR"}
 		output = append(output, metricsHeader)
 	}
 
-	file, _ := os.OpenFile("results/"+Program+"/"+mmStr+"-sys.csv", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	file, _ := os.OpenFile(c.summaryPath(), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	csvWriter := csv.NewWriter(file)
 
 	metricsData := []string{
-		strconv.Itoa(Goroutines),
+		strconv.Itoa(c.Goroutines),
 		strconv.FormatFloat(avgMetrics.ComputationTime/1_000_000, 'f', 2, 64),
 		strconv.FormatFloat(avgMetrics.Latency/1_000_000, 'f', 2, 64),
 		strconv.FormatFloat(avgMetrics.Throughput*1_000_000, 'f', 2, 64),
@@ -247,4 +494,40 @@ func writeSysStats(avgMetrics SystemMetrics, stdErrMetrics SystemMetrics, mm Mem
 	csvWriter.WriteAll(output)
 
 	file.Close()
-}
\ No newline at end of file
+}
+
+// writeLatencies writes the latency distributions the workload of the
+// configuration recorded to <G>-<MM>-latency.csv, with a column per histogram
+// of Histograms that has counts and a row per bucket.
+func writeLatencies(res result, c configuration) {
+	var columns []int
+	for i, counts := range res.Latencies {
+		for _, n := range counts {
+			if n > 0 {
+				columns = append(columns, i)
+				break
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return
+	}
+
+	header := []string{"Latency_ns"}
+	for _, i := range columns {
+		header = append(header, Histograms[i].Name)
+	}
+	data := [][]string{header}
+	for k := range res.Latencies[columns[0]] {
+		row := []string{strconv.FormatInt(BucketStart(k), 10)}
+		for _, i := range columns {
+			row = append(row, strconv.FormatInt(res.Latencies[i][k], 10))
+		}
+		data = append(data, row)
+	}
+
+	file, _ := os.OpenFile(c.path("latency.csv"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	csvWriter := csv.NewWriter(file)
+	csvWriter.WriteAll(data)
+	file.Close()
+}
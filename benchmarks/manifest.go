@@ -0,0 +1,115 @@
+//go:build goexperiment.regions
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The manifest records which configurations of a sweep have completed, so an
+// interrupted sweep can be resumed with -resume instead of restarting.
+type manifest struct {
+	BuildID string
+	Seed    uint64
+	Entries []manifestEntry
+}
+
+type manifestEntry struct {
+	Config configuration
+	Hash   string
+}
+
+func manifestPath() string {
+	return filepath.Join(exp.Results, "manifest.json")
+}
+
+// configHash identifies everything that determines the results of a configuration,
+// so results are only reused when they were measured the same way.
+func configHash(c configuration) string {
+	b, _ := json.Marshal(struct {
+		Config   configuration
+		WarmUp   int
+		Rounds   int
+		Workload workload
+	}{c, exp.WarmUp, exp.Rounds, exp.Workload})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// buildID identifies the running binary by the hash of its executable.
+func buildID() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// loadManifest reads the manifest of a previous sweep and verifies that its
+// results were produced by this binary with the same configurations.
+func loadManifest(configs []configuration, id string) (*manifest, error) {
+	b, err := os.ReadFile(manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", manifestPath(), err)
+	}
+
+	if m.BuildID != id {
+		return nil, fmt.Errorf("%s was produced by build %s, not %s; rerun without -resume", manifestPath(), m.BuildID, id)
+	}
+	for _, e := range m.Entries {
+		for _, c := range configs {
+			if c == e.Config && configHash(c) != e.Hash {
+				return nil, fmt.Errorf("%s: %s was measured with different settings; rerun without -resume", manifestPath(), c)
+			}
+		}
+	}
+	return &m, nil
+}
+
+func (m *manifest) completed(c configuration) bool {
+	for _, e := range m.Entries {
+		if e.Config == c && e.Hash == configHash(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// complete records c as completed and saves the manifest. The manifest is
+// written to a temporary file first so a crash cannot leave it truncated.
+func (m *manifest) complete(c configuration) error {
+	m.Entries = append(m.Entries, manifestEntry{c, configHash(c)})
+	return m.save()
+}
+
+func (m *manifest) save() error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := manifestPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, manifestPath())
+}
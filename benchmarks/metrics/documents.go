@@ -0,0 +1,60 @@
+package configurations
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+)
+
+// A Document is what the json workload decodes, its Total is left out of the
+// corpus and added by the workload.
+type Document struct {
+	ID    int      `json:"id"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Items []Item   `json:"items"`
+	Total *int     `json:"total,omitempty"`
+}
+
+type Item struct {
+	Name     string `json:"name"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+}
+
+// GenerateDocuments returns n encoded documents of items items each, together
+// with the Checksum of every document once transformed: its items without a
+// quantity dropped and the sum of price times quantity of the rest as Total.
+func GenerateDocuments(n int, items int, rng *rand.Rand) ([][]byte, []uint32) {
+	docs := make([][]byte, n)
+	expected := make([]uint32, n)
+	for i := range docs {
+		doc := Document{ID: i, Title: word(rng), Tags: []string{word(rng), word(rng), word(rng)}, Items: make([]Item, items)}
+		for j := range doc.Items {
+			doc.Items[j] = Item{Name: word(rng), Price: 1 + rng.IntN(1000), Quantity: rng.IntN(4)}
+		}
+		docs[i], _ = json.Marshal(doc)
+
+		total := 0
+		kept := doc.Items[:0]
+		for _, item := range doc.Items {
+			if item.Quantity > 0 {
+				total += item.Price * item.Quantity
+				kept = append(kept, item)
+			}
+		}
+		doc.Items = kept
+		doc.Total = &total
+		transformed, _ := json.Marshal(doc)
+		expected[i] = Checksum(transformed)
+	}
+	return docs, expected
+}
+
+// word returns 4 to 12 random lower case letters, which need no escaping in JSON.
+func word(rng *rand.Rand) string {
+	b := make([]byte, 4+rng.IntN(9))
+	for i := range b {
+		b[i] = byte('a' + rng.IntN(26))
+	}
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package configurations
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// A Histogram counts latencies in buckets of powers of two: bucket 0 holds the
+// latencies of 0 ns and bucket k those from 2^(k-1) up to 2^k ns.
+type Histogram [65]atomic.Int64
+
+// Latency distributions recorded by the workloads, reset before every run
+var (
+	// Sends and receives of channel-matrix
+	SendLatency, ReceiveLatency Histogram
+	// Region operations of region-lifecycle
+	CreateLatency, RemoveLatency, IncRefLatency, DecRefLatency Histogram
+)
+
+// Histograms lists the latency distributions with the names they are written under.
+var Histograms = []struct {
+	Name      string
+	Histogram *Histogram
+}{
+	{"Send", &SendLatency},
+	{"Receive", &ReceiveLatency},
+	{"Create", &CreateLatency},
+	{"Remove", &RemoveLatency},
+	{"IncRef", &IncRefLatency},
+	{"DecRef", &DecRefLatency},
+}
+
+func (h *Histogram) Record(ns int64) {
+	h[bits.Len64(uint64(max(ns, 0)))].Add(1)
+}
+
+func (h *Histogram) Reset() {
+	for i := range h {
+		h[i].Store(0)
+	}
+}
+
+// Counts returns the count of every bucket.
+func (h *Histogram) Counts() []int64 {
+	counts := make([]int64, len(h))
+	for i := range h {
+		counts[i] = h[i].Load()
+	}
+	return counts
+}
+
+// BucketStart returns the smallest latency in ns counted by bucket k.
+func BucketStart(k int) int64 {
+	if k == 0 {
+		return 0
+	}
+	return 1 << (k - 1)
+}
@@ -8,29 +8,155 @@ import (
 // Configurations
 const (
 	RegionBlockBytes = 8388608
-	// Amount of goroutines
-	Goroutines = 256
 
-	// mat-mul
-	Rows = 100 * (1 + (Goroutines >> 4))
-	Cols = Rows
+	// Largest payload of a serv-hand request
+	ServHandMaxPayload = 1024
+)
 
+// Configurations that can be changed by an experiment file
+var (
 	//bin-tree
-	BinOp    = 2000
-	BinRange = BinOp * Goroutines
+	BinOp   = 2000
+	BinMix  = OperationMix{Insert: 100}
+	BinKeys = Sequential
 
 	//pro-con
 	ProConOp = 10000
 
-	//serv-hand
-	ServHandOp = 100
+	//serv-hand, payload bytes of every request and requests sent per connection
+	ServHandOp        = 100
+	ServHandPayload   = 256
+	ServHandKeepAlive = 1
+	// Transport between the clients and the server: tcp, unix or pipe, see Listen
+	ServHandNetwork = "tcp"
+
+	//http, requests per client and values in the JSON body of every request
+	HTTPOp     = 100
+	HTTPValues = 16
+
+	//pipeline, records parsed per goroutine, stages including parse and aggregate and records per batch
+	PipelineOp     = 1000
+	PipelineStages = 4
+	PipelineBatch  = 1
+
+	//worker-pool, jobs per worker and ints in the scratch slice of every job
+	WorkerPoolJobs    = 1000
+	WorkerPoolScratch = 256
+
+	//lru-cache, gets per goroutine, shards and entries per shard
+	LRUOp       = 2000
+	LRUShards   = 16
+	LRUCapacity = 256
+	// Percentage of gets for keys that fit in the cache and percentage of misses that insert, evicting an entry once full
+	LRUHitRatio  = 80
+	LRUEvictRate = 100
+	// Bytes of every cached value, drawn uniformly
+	LRUValueMin = 64
+	LRUValueMax = 1024
+
+	//graph, vertices, edges added by every vertex and shape of the graph: uniform or power-law
+	GraphVertices = 10000
+	GraphDegree   = 4
+	GraphShape    = "uniform"
+	// Breadth-first searches per goroutine
+	GraphQueries = 10
+
+	//json, documents in the corpus and processed per goroutine and items per document
+	JSONDocs  = 100
+	JSONItems = 16
+
+	//string-builder, log lines per goroutine, most key=value fields per line and lines per log before it is flushed
+	StringOp     = 2000
+	StringFields = 8
+	StringFlush  = 100
+
+	//alloc-sweep, object sizes in bytes, each a power of two from 8 bytes to 16 MB
+	AllocSweepSizes = []int{8, 64, 512, 4096, 32768, 262144, 2097152, RegionBlockBytes, 2 * RegionBlockBytes}
+	// Objects allocated per run, fewer for sizes that would exceed the budget in bytes
+	AllocSweepCount  = 10000
+	AllocSweepBudget = 256 << 20
+
+	//channel-matrix, messages per sender, channel buffers, payload bytes and senders x receivers per goroutine
+	ChannelMessages = 10000
+	ChannelBuffers  = []int{0, 1, 64}
+	ChannelPayloads = []int{8, 256, 4096}
+	ChannelRatios   = []string{"1x1", "1x4", "4x1"}
+
+	//region-lifecycle, cycles per run, initial region sizes, objects per region and nested regions per cycle
+	LifecycleCycles  = 100
+	LifecycleSizes   = []int{0, 4096, RegionBlockBytes, 4 * RegionBlockBytes}
+	LifecycleObjects = []int{0, 100, 10000}
+	LifecycleDepths  = []int{1, 4}
+
+	//nested-regions, requests per goroutine, sub-tasks started by every task, levels of sub-tasks and objects per task
+	NestedRequests = 200
+	NestedFanout   = 3
+	NestedDepth    = 3
+	NestedObjects  = 8
 
 	//hash-map
-	HashOp    = 2000
-	HashRange = HashOp
-	HashCap   = (HashRange * Goroutines * 4) / 3
+	HashOp   = 2000
+	HashMix  = OperationMix{Insert: 100}
+	HashKeys = Sequential
+
+	//hash-map-resize, buckets of the first table and values per bucket before it doubles
+	HashInitCap    = 16
+	HashLoadFactor = 4
+
+	// Skew of the Zipfian key distribution, larger is hotter
+	ZipfSkew = 1.1
+
+	// mat-mul, rows and columns of the matrices, 0 scales them with the amount of goroutines
+	MatrixSize = 0
+
+	// GC percentage set by every workload, -1 turns the GC off during a run
+	GCPercent = -1
+
+	// Seed of the random number generators of the workloads
+	Seed uint64 = 1
+
+	// Makes the workloads check their results, a wrong result fails the run, see Fail
+	Verify = false
+)
+
+// Configurations derived from the amount of goroutines, see SetGoroutines
+var (
+	// Amount of goroutines
+	Goroutines int
+
+	// mat-mul
+	Rows int
+	Cols int
+
+	//bin-tree
+	BinRange int
+
+	//hash-map
+	HashRange int
+	HashCap   int
 )
 
+func init() {
+	SetGoroutines(256)
+}
+
+// SetGoroutines sets the amount of goroutines used by the workloads and
+// recomputes the configurations that are derived from it.
+func SetGoroutines(g int) {
+	Goroutines = g
+
+	Rows = MatrixSize
+	if Rows == 0 {
+		Rows = 100 * (1 + (Goroutines >> 4))
+	}
+	Cols = Rows
+
+	BinRange = BinOp * Goroutines
+
+	HashRange = HashOp
+	HashCap = (HashRange * Goroutines * 4) / 3
+}
+
 var ComputationTime atomic.Int64
 var Throughput atomic.Int64
 var Latency atomic.Int64
@@ -0,0 +1,125 @@
+package configurations
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// An OperationMix holds the percentages of inserts, searches and removes done by a workload.
+type OperationMix struct {
+	Insert int
+	Search int
+	Remove int
+}
+
+// Valid reports whether Pick can draw from the mix: no percentage is negative
+// and they do not add up to zero.
+func (m OperationMix) Valid() bool {
+	return m.Insert >= 0 && m.Search >= 0 && m.Remove >= 0 && m.Insert+m.Search+m.Remove > 0
+}
+
+// Pick returns the next operation: 0 for an insert, 1 for a search and 2 for a remove.
+func (m OperationMix) Pick(rng *rand.Rand) int {
+	if m.Search == 0 && m.Remove == 0 {
+		return 0
+	}
+	n := rng.IntN(m.Insert + m.Search + m.Remove)
+	switch {
+	case n < m.Insert:
+		return 0
+	case n < m.Insert+m.Search:
+		return 1
+	}
+	return 2
+}
+
+// KeyDistribution decides which keys the operations of a workload use.
+type KeyDistribution int
+
+const (
+	// Every goroutine inserts the keys of its own range in order
+	Sequential KeyDistribution = iota
+	// Keys are drawn uniformly from the whole key range
+	Uniform
+	// Keys are drawn from a Zipf distribution, so a few hot keys get most operations
+	Zipfian
+)
+
+func (d KeyDistribution) MarshalText() ([]byte, error) {
+	switch d {
+	case Sequential:
+		return []byte("sequential"), nil
+	case Uniform:
+		return []byte("uniform"), nil
+	case Zipfian:
+		return []byte("zipfian"), nil
+	}
+	return nil, fmt.Errorf("unknown key distribution %d", int(d))
+}
+
+func (d *KeyDistribution) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "sequential":
+		*d = Sequential
+	case "uniform":
+		*d = Uniform
+	case "zipfian":
+		*d = Zipfian
+	default:
+		return fmt.Errorf("unknown key distribution %q", b)
+	}
+	return nil
+}
+
+// A KeyGenerator produces the keys used by one goroutine of a workload.
+type KeyGenerator struct {
+	distribution KeyDistribution
+	first        int
+	keyRange     int
+	inserted     int
+	rng          *rand.Rand
+	zipf         rand.Zipf
+}
+
+// Init prepares g to produce keys first+1, first+2, ... of the goroutine's own
+// range when sequential, or keys from [1, keyRange] otherwise. Keys are never 0,
+// which the hash map uses for empty entries.
+func (g *KeyGenerator) Init(d KeyDistribution, first int, keyRange int, rng *rand.Rand) {
+	g.distribution = d
+	g.first = first
+	g.keyRange = keyRange
+	g.inserted = 0
+	g.rng = rng
+	if d == Zipfian {
+		g.zipf = *rand.NewZipf(rng, ZipfSkew, 1, uint64(keyRange-1))
+	}
+}
+
+// Insert returns the key of the next insert.
+func (g *KeyGenerator) Insert() int {
+	if g.distribution == Sequential {
+		g.inserted++
+		return g.first + g.inserted
+	}
+	return g.random()
+}
+
+// Existing returns the key of the next search or remove. Sequential keys are
+// drawn from those the goroutine already inserted.
+func (g *KeyGenerator) Existing() int {
+	if g.distribution == Sequential {
+		if g.inserted == 0 {
+			return g.first + 1
+		}
+		return g.first + g.rng.IntN(g.inserted) + 1
+	}
+	return g.random()
+}
+
+func (g *KeyGenerator) random() int {
+	if g.distribution == Zipfian {
+		// The hottest key is 1
+		return int(g.zipf.Uint64()) + 1
+	}
+	return g.rng.IntN(g.keyRange) + 1
+}
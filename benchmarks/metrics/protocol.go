@@ -0,0 +1,44 @@
+package configurations
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The serv-hand protocol frames every message as its length in 4 bytes,
+// big-endian, followed by the body. A request body is the payload of the client
+// and the response body is the checksum of that payload followed by the payload.
+
+// WriteMessage writes body as one message, header is the scratch space of the length.
+func WriteMessage(w io.Writer, header *[4]byte, body []byte) error {
+	binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// ReadMessage reads one message into buf and returns the length of its body.
+func ReadMessage(r io.Reader, header *[4]byte, buf []byte) (int, error) {
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint32(header[:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("message of %d bytes does not fit in %d", n, len(buf))
+	}
+	_, err := io.ReadFull(r, buf[:n])
+	return n, err
+}
+
+// Checksum is the 32 bit FNV-1a hash of b.
+func Checksum(b []byte) uint32 {
+	h := uint32(2166136261)
+	for _, c := range b {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return h
+}
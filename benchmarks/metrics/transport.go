@@ -0,0 +1,74 @@
+package configurations
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var sockets atomic.Int64
+
+// Listen opens a listener on network, which is "tcp" for an ephemeral port on
+// loopback, "unix" for a Unix domain socket in the temporary directory or "pipe"
+// for in-memory connections made with net.Pipe. Connect to it with Dial.
+func Listen(network string) (net.Listener, error) {
+	switch network {
+	case "tcp":
+		return net.Listen("tcp", "127.0.0.1:0")
+	case "unix":
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("benchmarks-%d-%d.sock", os.Getpid(), sockets.Add(1)))
+		return net.Listen("unix", path)
+	case "pipe":
+		return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}, nil
+	}
+	return nil, fmt.Errorf("unknown network %q", network)
+}
+
+// Dial connects to the address of a listener opened by Listen.
+func Dial(addr net.Addr) (net.Conn, error) {
+	if l, ok := addr.(*pipeListener); ok {
+		return l.dial()
+	}
+	return net.Dial(addr.Network(), addr.String())
+}
+
+// A pipeListener hands the server ends of net.Pipe connections to Accept. It is
+// its own address, so Dial can find it.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *pipeListener) dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr  { return l }
+func (l *pipeListener) Network() string { return "pipe" }
+func (l *pipeListener) String() string  { return "pipe" }
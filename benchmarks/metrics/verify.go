@@ -0,0 +1,30 @@
+package configurations
+
+import (
+	"fmt"
+	"sync"
+)
+
+var verification struct {
+	mu  sync.Mutex
+	err error
+}
+
+// Fail records that a workload produced a wrong result, which fails the current
+// run. Only the first failure of a run is kept.
+func Fail(format string, args ...any) {
+	verification.mu.Lock()
+	if verification.err == nil {
+		verification.err = fmt.Errorf(format, args...)
+	}
+	verification.mu.Unlock()
+}
+
+// Failed returns why the last run failed, if it did, and clears it for the next run.
+func Failed() error {
+	verification.mu.Lock()
+	err := verification.err
+	verification.err = nil
+	verification.mu.Unlock()
+	return err
+}
@@ -0,0 +1,385 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// An AVL tree never gets more than 1.44*log2(n) levels deep, so this bounds the
+// amount of nodes an insert keeps locked.
+const maxAVLHeight = 64
+
+type AVLNode struct {
+	value int
+	// Height of the right subtree minus the height of the left one, -1, 0 or 1
+	balance int
+	left    *AVLNode
+	right   *AVLNode
+	mu      sync.Mutex
+}
+
+// An AVLTree is a balanced alternative to FineGrainBinaryTree with a lock per node.
+// Searches couple the locks of a node and its child on their way down. Inserts keep
+// the nodes from the parent of the deepest unbalanced node on their path locked,
+// since only those can be rebalanced. Removes may rebalance every level, so they
+// hold mu exclusively while inserts and searches share it.
+type AVLTree struct {
+	mu sync.RWMutex
+	// Sentinel whose right child is the root, so the root is relinked like any other node
+	head AVLNode
+	r    *region.Region
+
+	// Nodes of removed values, kept for reuse since a region cannot free single objects
+	poolMu sync.Mutex
+	free   *AVLNode
+}
+
+// child returns the link to the left child of n for a < 0 and to the right child otherwise.
+func (n *AVLNode) child(a int) **AVLNode {
+	if a < 0 {
+		return &n.left
+	}
+	return &n.right
+}
+
+func NewAVLTree(r *region.Region) *AVLTree {
+	allocationStart := time.Now()
+	t := region.AllocFromRegion[AVLTree](r)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	t.r = r
+	return t
+}
+
+// newNode returns a node holding value, recycled if possible and otherwise allocated from the region of the tree.
+func (tree *AVLTree) newNode(value int) *AVLNode {
+	tree.poolMu.Lock()
+	n := tree.free
+	if n != nil {
+		tree.free = n.left
+	}
+	tree.poolMu.Unlock()
+
+	if n == nil {
+		allocationStart := time.Now()
+		n = region.AllocFromRegion[AVLNode](tree.r)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	}
+	n.value = value
+	n.balance = 0
+	n.left = nil
+	n.right = nil
+	return n
+}
+
+// rotate rebalances s, whose a side is two levels higher than the other one,
+// and returns the new root of the subtree.
+func (s *AVLNode) rotate(a int) *AVLNode {
+	r := *s.child(a)
+	if r.balance == -a {
+		p := *r.child(-a)
+		*r.child(-a) = *p.child(a)
+		*p.child(a) = r
+		*s.child(a) = *p.child(-a)
+		*p.child(-a) = s
+
+		s.balance, r.balance = 0, 0
+		if p.balance == a {
+			s.balance = -a
+		} else if p.balance == -a {
+			r.balance = a
+		}
+		p.balance = 0
+		return p
+	}
+
+	*s.child(a) = *r.child(-a)
+	*r.child(-a) = s
+	if r.balance == a {
+		s.balance, r.balance = 0, 0
+	} else {
+		// Only after a remove
+		s.balance, r.balance = a, -a
+	}
+	return r
+}
+
+// shrunk rebalances n after its a side got one level lower, and returns the
+// new root of the subtree and whether the subtree got lower as well.
+func (n *AVLNode) shrunk(a int) (*AVLNode, bool) {
+	switch n.balance {
+	case a:
+		n.balance = 0
+		return n, true
+	case 0:
+		n.balance = -a
+		return n, false
+	}
+	lower := (*n.child(-a)).balance != 0
+	return n.rotate(-a), lower
+}
+
+// remove removes value from the subtree of n and returns the new root of the
+// subtree, whether it got lower and the unlinked node, if any.
+func (n *AVLNode) remove(value int) (*AVLNode, bool, *AVLNode) {
+	if n == nil {
+		return nil, false, nil
+	}
+	a := 0
+	if value < n.value {
+		a = -1
+	} else if value > n.value {
+		a = 1
+	} else if n.left == nil {
+		return n.right, true, n
+	} else if n.right == nil {
+		return n.left, true, n
+	} else {
+		// Take over the value of the successor, which is unlinked instead
+		var lower bool
+		var freed *AVLNode
+		n.right, lower, freed = n.right.removeMin()
+		n.value = freed.value
+		if lower {
+			root, rootLower := n.shrunk(1)
+			return root, rootLower, freed
+		}
+		return n, false, freed
+	}
+
+	c, lower, freed := (*n.child(a)).remove(value)
+	*n.child(a) = c
+	if lower {
+		root, rootLower := n.shrunk(a)
+		return root, rootLower, freed
+	}
+	return n, false, freed
+}
+
+func (n *AVLNode) removeMin() (*AVLNode, bool, *AVLNode) {
+	if n.left == nil {
+		return n.right, true, n
+	}
+	var lower bool
+	var freed *AVLNode
+	n.left, lower, freed = n.left.removeMin()
+	if lower {
+		root, rootLower := n.shrunk(-1)
+		return root, rootLower, freed
+	}
+	return n, false, freed
+}
+
+// Insert follows Knuth's algorithm A. s is the deepest node on the path whose
+// balance is not 0: the balances below it change, it may need a rotation and
+// nothing above it is affected, so only t, the parent of s, and the nodes
+// below t stay locked.
+func (tree *AVLTree) Insert(value int) bool {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	var locked [maxAVLHeight + 1]*AVLNode
+	n := 0
+
+	t := &tree.head
+	t.mu.Lock()
+	locked[n] = t
+	n++
+
+	s := t.right
+	if s == nil {
+		t.right = tree.newNode(value)
+		t.mu.Unlock()
+		return true
+	}
+	s.mu.Lock()
+	locked[n] = s
+	n++
+
+	p := s
+	for {
+		if value == p.value {
+			for i := 0; i < n; i++ {
+				locked[i].mu.Unlock()
+			}
+			return false
+		}
+		q := *p.child(value - p.value)
+		if q == nil {
+			break
+		}
+		q.mu.Lock()
+		if q.balance != 0 {
+			// Release everything above p, the new t
+			k := 0
+			for locked[k] != p {
+				locked[k].mu.Unlock()
+				k++
+			}
+			n = copy(locked[:], locked[k:n])
+			t, s = p, q
+		}
+		locked[n] = q
+		n++
+		p = q
+	}
+
+	q := tree.newNode(value)
+	*p.child(value - p.value) = q
+
+	a := 1
+	if value < s.value {
+		a = -1
+	}
+	for r := *s.child(a); r != q; {
+		if value < r.value {
+			r.balance = -1
+			r = r.left
+		} else {
+			r.balance = 1
+			r = r.right
+		}
+	}
+
+	switch s.balance {
+	case 0:
+		s.balance = a
+	case -a:
+		s.balance = 0
+	default:
+		root := s.rotate(a)
+		if t.right == s {
+			t.right = root
+		} else {
+			t.left = root
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		locked[i].mu.Unlock()
+	}
+	return true
+}
+
+func (tree *AVLTree) Search(value int) bool {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	p := &tree.head
+	p.mu.Lock()
+	n := p.right
+	for n != nil {
+		n.mu.Lock()
+		p.mu.Unlock()
+		if value == n.value {
+			n.mu.Unlock()
+			return true
+		}
+		p = n
+		n = *n.child(value - n.value)
+	}
+	p.mu.Unlock()
+	return false
+}
+
+func (tree *AVLTree) Remove(value int) bool {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	var freed *AVLNode
+	tree.head.right, _, freed = tree.head.right.remove(value)
+	if freed == nil {
+		return false
+	}
+
+	tree.poolMu.Lock()
+	freed.left = tree.free
+	tree.free = freed
+	tree.poolMu.Unlock()
+	return true
+}
+
+func generateAVLTreeOperations(id int, valueRange int, op int, tree *AVLTree, done chan bool, r1 *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	keys := region.AllocFromRegion[KeyGenerator](r2)
+	latencyStart := region.AllocFromRegion[time.Time](r2)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+	keys.Init(BinKeys, valueRange, BinRange, rng)
+
+	for i := region.AllocFromRegion[int](r2); *i < op; *i++ {
+		*latencyStart = time.Now()
+		switch opType(BinMix.Pick(rng)) {
+		case OpInsert:
+			tree.Insert(keys.Insert())
+		case OpSearch:
+			tree.Search(keys.Existing())
+		case OpRemove:
+			tree.Remove(keys.Existing())
+		}
+		Latency.Add(time.Since(*latencyStart).Nanoseconds())
+	}
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r1.DecRefCounter()
+	done <- true
+}
+
+func RunAVLTree(op int) SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(RegionBlockBytes / 8)
+
+	allocationTimeStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	tree := NewAVLTree(r1)
+
+	valueRange := 0
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go generateAVLTreeOperations(i, valueRange, op, tree, done, r1)
+		}
+		valueRange += BinOp
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(BinOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
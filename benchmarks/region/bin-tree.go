@@ -5,9 +5,13 @@ package region
 import (
 	. "experiments/benchmarks/metrics"
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"region"
 	"runtime"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,34 +21,101 @@ const (
 	OpInsert opType = iota
 	OpSearch
 	OpRemove
+	// Removes the smallest value of a subtree, used to find the successor of a removed value
+	opRemoveMin
 )
 
 type request struct {
 	value        int
 	op           opType
 	result       chan bool
+	removed      chan removal
 	latencyStart time.Time
 }
 
+// A removal is the answer of a node to a remove sent by its parent, which
+// waits for it before handling its next request.
+type removal struct {
+	// Subtree replacing the one the remove was sent to
+	node *Node
+	// Node unlinked from the tree, its goroutine is stopping
+	freed *Node
+	// Value of the freed node
+	value int
+}
+
 type Node struct {
 	value int
 	left  *Node
 	right *Node
 	reqs  chan request
 	done  chan bool
+	// Request being handled and the channel removals of children are answered
+	// on, allocated with the node so that a recycled node does not grow the region
+	req     *request
+	removed chan removal
 }
 
 type FineGrainBinaryTree struct {
 	root *Node
 	reqs chan request
 	done chan bool
+	pool nodePool
+	// Values inserted minus values removed, only counted with Verify
+	size atomic.Int64
 }
 
-func (n *Node) run(r1 *region.Region) {
-	allocationStart := time.Now()
-	req := region.AllocFromRegion[request](r1)
-	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+// nodePool recycles the nodes of removed values, since a region cannot free single objects.
+type nodePool struct {
+	mu   sync.Mutex
+	free *Node
+}
+
+// get returns a node holding value and starts its goroutine. The node is
+// recycled if possible and otherwise allocated from r.
+func (p *nodePool) get(value int, r *region.Region) *Node {
+	p.mu.Lock()
+	n := p.free
+	if n != nil {
+		p.free = n.left
+	}
+	p.mu.Unlock()
+
+	if n == nil {
+		allocationStart := time.Now()
+		n = region.AllocFromRegion[Node](r)
+		n.reqs = region.AllocChannel[request](0, r)
+		n.done = region.AllocChannel[bool](0, r)
+		n.req = region.AllocFromRegion[request](r)
+		n.removed = region.AllocChannel[removal](0, r)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	}
+	n.value = value
+	n.left = nil
+	n.right = nil
+
+	if r.IncRefCounter() {
+		go n.run(r, p)
+	}
+	return n
+}
+
+// put waits for the goroutine of a freed node to stop and keeps the node for reuse.
+func (p *nodePool) put(n *Node, r *region.Region) {
+	if n == nil {
+		return
+	}
+	<-n.done
+	r.DecRefCounter()
+
+	p.mu.Lock()
+	n.left = p.free
+	p.free = n
+	p.mu.Unlock()
+}
 
+func (n *Node) run(r1 *region.Region, pool *nodePool) {
+	req, removed := n.req, n.removed
 	for *req = range n.reqs {
 		switch req.op {
 		case OpInsert:
@@ -52,17 +123,7 @@ func (n *Node) run(r1 *region.Region) {
 				if n.left == nil {
 					Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 
-					allocationStart = time.Now()
-					n.left = region.AllocFromRegion[Node](r1)
-					n.left.reqs = region.AllocChannel[request](0, r1)
-					n.left.done = region.AllocChannel[bool](0, r1)
-					AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
-
-					n.left.value = req.value
-
-					if r1.IncRefCounter() {
-						go n.left.run(r1)
-					}
+					n.left = pool.get(req.value, r1)
 
 					req.result <- true
 				} else {
@@ -72,17 +133,7 @@ func (n *Node) run(r1 *region.Region) {
 				if n.right == nil {
 					Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 
-					allocationStart = time.Now()
-					n.right = region.AllocFromRegion[Node](r1)
-					n.right.reqs = region.AllocChannel[request](0, r1)
-					n.right.done = region.AllocChannel[bool](0, r1)
-					AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
-
-					n.right.value = req.value
-
-					if r1.IncRefCounter() {
-						go n.right.run(r1)
-					}
+					n.right = pool.get(req.value, r1)
 
 					req.result <- true
 				} else {
@@ -104,11 +155,71 @@ func (n *Node) run(r1 *region.Region) {
 				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 				req.result <- false
 			}
+		case OpRemove:
+			parent := req.removed
+			if req.value < n.value && n.left != nil {
+				req.removed = removed
+				n.left.reqs <- *req
+				rem := <-removed
+				n.left = rem.node
+				pool.put(rem.freed, r1)
+				parent <- removal{node: n}
+			} else if req.value > n.value && n.right != nil {
+				req.removed = removed
+				n.right.reqs <- *req
+				rem := <-removed
+				n.right = rem.node
+				pool.put(rem.freed, r1)
+				parent <- removal{node: n}
+			} else if req.value != n.value {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- false
+				parent <- removal{node: n}
+			} else if n.left != nil && n.right != nil {
+				// Take over the value of the successor, which is removed instead
+				n.right.reqs <- request{op: opRemoveMin, removed: removed}
+				rem := <-removed
+				n.value = rem.value
+				n.right = rem.node
+				pool.put(rem.freed, r1)
+
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- true
+				parent <- removal{node: n}
+			} else {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- true
+				n.unlink(parent)
+				return
+			}
+		case opRemoveMin:
+			parent := req.removed
+			if n.left != nil {
+				req.removed = removed
+				n.left.reqs <- *req
+				rem := <-removed
+				n.left = rem.node
+				pool.put(rem.freed, r1)
+				parent <- removal{node: n, value: rem.value}
+			} else {
+				n.unlink(parent)
+				return
+			}
 		}
 	}
 	n.done <- true
 }
 
+// unlink replaces n by its only child, if any, and stops the goroutine of n.
+func (n *Node) unlink(parent chan removal) {
+	child := n.left
+	if child == nil {
+		child = n.right
+	}
+	parent <- removal{node: child, freed: n, value: n.value}
+	n.done <- true
+}
+
 func NewFineGrainBinaryTree(r *region.Region) *FineGrainBinaryTree {
 	allocationStart := time.Now()
 	t := region.AllocFromRegion[FineGrainBinaryTree](r)
@@ -126,6 +237,7 @@ func NewFineGrainBinaryTree(r *region.Region) *FineGrainBinaryTree {
 func (t *FineGrainBinaryTree) run(r1 *region.Region) {
 	allocationStart := time.Now()
 	req := region.AllocFromRegion[request](r1)
+	removed := region.AllocChannel[removal](0, r1)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
 	for *req = range t.reqs {
@@ -134,17 +246,7 @@ func (t *FineGrainBinaryTree) run(r1 *region.Region) {
 			if t.root == nil {
 				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
 
-				allocationStart = time.Now()
-				t.root = region.AllocFromRegion[Node](r1)
-				t.root.reqs = region.AllocChannel[request](0, r1)
-				t.root.done = region.AllocChannel[bool](0, r1)
-				AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
-
-				t.root.value = req.value
-
-				if r1.IncRefCounter() {
-					go t.root.run(r1)
-				}
+				t.root = t.pool.get(req.value, r1)
 
 				req.result <- true
 			} else {
@@ -157,46 +259,77 @@ func (t *FineGrainBinaryTree) run(r1 *region.Region) {
 			} else {
 				t.root.reqs <- *req
 			}
+		case OpRemove:
+			if t.root == nil {
+				Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+				req.result <- false
+			} else {
+				req.removed = removed
+				t.root.reqs <- *req
+				rem := <-removed
+				t.root = rem.node
+				t.pool.put(rem.freed, r1)
+			}
 		}
 	}
 	t.done <- true
 }
 
-func (tree *FineGrainBinaryTree) Insert(value int, req request) {
+func (tree *FineGrainBinaryTree) Insert(value int, req request) bool {
 	req.value = value
 	req.op = OpInsert
 	req.latencyStart = time.Now()
 
 	tree.reqs <- req
-	<-req.result
+	return <-req.result
 }
 
-func (tree *FineGrainBinaryTree) Search(value int, req request) {
+func (tree *FineGrainBinaryTree) Search(value int, req request) bool {
 	req.value = value
 	req.op = OpSearch
 	req.latencyStart = time.Now()
 
 	tree.reqs <- req
-	<-req.result
+	return <-req.result
 }
 
-func generateBinaryTreeOperations(valueRange int, op int, tree *FineGrainBinaryTree, done chan bool, r1 *region.Region) {
+func (tree *FineGrainBinaryTree) Remove(value int, req request) bool {
+	req.value = value
+	req.op = OpRemove
+	req.latencyStart = time.Now()
+
+	tree.reqs <- req
+	return <-req.result
+}
+
+func generateBinaryTreeOperations(id int, valueRange int, op int, tree *FineGrainBinaryTree, done chan bool, r1 *region.Region) {
 	r2 := region.CreateRegion(0)
 
 	allocationStart := time.Now()
 	req := region.AllocFromRegion[request](r2)
 	req.result = region.AllocChannel[bool](0, r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	keys := region.AllocFromRegion[KeyGenerator](r2)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+	keys.Init(BinKeys, valueRange, BinRange, rng)
+
 	for i := region.AllocFromRegion[int](r2); *i < op; *i++ {
-		tree.Insert(*i + valueRange, *req)
-		/*val := rand.IntN(valueRange) + 1
-		switch method := opType(rand.IntN(2)); method {
+		switch opType(BinMix.Pick(rng)) {
 		case OpInsert:
-			tree.Insert(val, *req)
+			if tree.Insert(keys.Insert(), *req) && Verify {
+				tree.size.Add(1)
+			}
 		case OpSearch:
-			tree.Search(val, *req)
-		}*/
+			tree.Search(keys.Existing(), *req)
+		case OpRemove:
+			if tree.Remove(keys.Existing(), *req) && Verify {
+				tree.size.Add(-1)
+			}
+		}
 	}
 	deallocationStart := time.Now()
 	r2.RemoveRegion()
@@ -218,6 +351,29 @@ func (n *Node) Print() {
 	}
 }
 
+// validate checks that the tree is a binary search tree holding the values that
+// were inserted and not removed, and fails the run otherwise.
+func (tree *FineGrainBinaryTree) validate() {
+	count := 0
+	if !tree.root.check(math.MinInt, math.MaxInt, &count) {
+		Fail("bin-tree: values are out of order or stored twice")
+		return
+	}
+	if int64(count) != tree.size.Load() {
+		Fail("bin-tree: holds %d values, expected %d", count, tree.size.Load())
+	}
+}
+
+// check counts the nodes of the subtree of n and reports whether their values
+// are ordered and within (lo, hi).
+func (n *Node) check(lo int, hi int, count *int) bool {
+	if n == nil {
+		return true
+	}
+	*count++
+	return lo < n.value && n.value < hi && n.left.check(lo, n.value, count) && n.right.check(n.value, hi, count)
+}
+
 func (n *Node) destroyTree(r *region.Region) {
 	close(n.reqs)
 	<-n.done
@@ -231,7 +387,7 @@ func (n *Node) destroyTree(r *region.Region) {
 }
 
 func RunBinaryTree(op int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -251,7 +407,7 @@ func RunBinaryTree(op int) SystemMetrics {
 	valueRange := 0
 	for i := 0; i < Goroutines; i++ {
 		if r1.IncRefCounter() {
-			go generateBinaryTreeOperations(valueRange, op, fgbt, done, r1)
+			go generateBinaryTreeOperations(i, valueRange, op, fgbt, done, r1)
 		}
 		valueRange += BinOp
 	}
@@ -260,17 +416,28 @@ func RunBinaryTree(op int) SystemMetrics {
 		<-done
 	}
 
-	// Decrement each reference counter
-	fgbt.root.destroyTree(r1)
+	// The tree is only validated once its goroutine finished the last remove
 	close(fgbt.reqs)
 	<-fgbt.done
 	r1.DecRefCounter()
 
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		fgbt.validate()
+		verification = time.Since(verificationStart)
+	}
+
+	// Decrement each reference counter
+	if fgbt.root != nil {
+		fgbt.root.destroyTree(r1)
+	}
+
 	deallocationStart := time.Now()
 	r1.RemoveRegion()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
 
 	runtime.GC()
 
@@ -0,0 +1,228 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A Vertex points at its neighbours, the graph is undirected so every edge is
+// held by both of its vertices.
+type Vertex struct {
+	id    int
+	edges []*Vertex
+}
+
+// generateEdges returns the endpoints of the edges of the graph, edge e joins
+// ends[2e] and ends[2e+1]. Every vertex adds GraphDegree edges, to uniformly
+// drawn vertices or, for a power-law graph, to the ends of uniformly drawn
+// edges, which attaches vertices to the vertices that already have many.
+func generateEdges(rng *rand.Rand, r *region.Region) []int {
+	allocationStart := time.Now()
+	ends := allocSlice[int](2*GraphVertices*GraphDegree, r)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for n := 0; n < len(ends); n += 2 {
+		ends[n] = n / 2 / GraphDegree
+		ends[n+1] = rng.IntN(GraphVertices)
+		if GraphShape == "power-law" && n > 0 {
+			ends[n+1] = ends[rng.IntN(n)]
+		}
+	}
+	return ends
+}
+
+// generateGraph allocates the graph from r1, the edges it is built from are
+// allocated from a region of their own that is removed once it is built.
+func generateGraph(r1 *region.Region) []*Vertex {
+	r2 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	pcg.Seed(Seed, 0)
+	*rng = *rand.New(pcg)
+	ends := generateEdges(rng, r2)
+
+	allocationStart = time.Now()
+	degrees := allocSlice[int](GraphVertices, r2)
+	graph := allocSlice[*Vertex](GraphVertices, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for _, v := range ends {
+		degrees[v]++
+	}
+	for v := range graph {
+		allocationStart = time.Now()
+		graph[v] = region.AllocFromRegion[Vertex](r1)
+		graph[v].edges = allocSlice[*Vertex](degrees[v], r1)[:0]
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		graph[v].id = v
+	}
+	for e := 0; e < len(ends); e += 2 {
+		from, to := graph[ends[e]], graph[ends[e+1]]
+		from.edges = append(from.edges, to)
+		to.edges = append(to.edges, from)
+	}
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	return graph
+}
+
+// components labels every vertex with its connected component and returns the
+// size of every component.
+func components(graph []*Vertex) ([]int, []int) {
+	label := make([]int, len(graph))
+	for v := range label {
+		label[v] = -1
+	}
+	var sizes []int
+	var stack []*Vertex
+	for _, s := range graph {
+		if label[s.id] >= 0 {
+			continue
+		}
+		label[s.id] = len(sizes)
+		sizes = append(sizes, 0)
+		stack = append(stack, s)
+		for len(stack) > 0 {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sizes[len(sizes)-1]++
+			for _, w := range v.edges {
+				if label[w.id] < 0 {
+					label[w.id] = label[s.id]
+					stack = append(stack, w)
+				}
+			}
+		}
+	}
+	return label, sizes
+}
+
+// bfs returns the amount of vertices reachable from source. The frontier and
+// the visited set of the traversal live in a region that is removed once it is done.
+func bfs(graph []*Vertex, source *Vertex) int {
+	r := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	visited := allocSlice[bool](len(graph), r)
+	frontier := allocSlice[*Vertex](len(graph), r)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	visited[source.id] = true
+	frontier[0] = source
+	head, tail := 0, 1
+	for head < tail {
+		v := frontier[head]
+		head++
+		for _, w := range v.edges {
+			if !visited[w.id] {
+				visited[w.id] = true
+				frontier[tail] = w
+				tail++
+			}
+		}
+	}
+	reached := tail
+
+	deallocationStart := time.Now()
+	r.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	return reached
+}
+
+func generateGraphQueries(id int, graph []*Vertex, label []int, sizes []int, done chan bool, r *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	i := region.AllocFromRegion[int](r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	pcg.Seed(Seed, uint64(id+1))
+	*rng = *rand.New(pcg)
+
+	for *i = 0; *i < GraphQueries; *i++ {
+		source := graph[rng.IntN(len(graph))]
+
+		latencyStart := time.Now()
+		reached := bfs(graph, source)
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		if Verify && reached != sizes[label[source.id]] {
+			Fail("graph: bfs from %d reached %d vertices, its component has %d", source.id, reached, sizes[label[source.id]])
+		}
+	}
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r.DecRefCounter()
+	done <- true
+}
+
+func RunGraph() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	graph := generateGraph(r1)
+
+	var verification time.Duration
+	var label, sizes []int
+	if Verify {
+		verificationStart := time.Now()
+		label, sizes = components(graph)
+		verification = time.Since(verificationStart)
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go generateGraphQueries(i, graph, label, sizes, done, r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(GraphQueries*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -4,9 +4,11 @@ package region
 
 import (
 	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
 	"region"
 	"runtime"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,56 +17,74 @@ type list struct {
 	next  *list
 }
 
-func (l *list) push(v int, r *region.Region) bool {
+func (l *list) push(v int, b *bucket, r *region.Region) bool {
 	if l.value == v {
 		return false
 	} else if l.value == 0 {
 		l.value = v
 		return true
 	} else if l.next == nil {
-		allocationTimeStart := time.Now()
-		l.next = region.AllocFromRegion[list](r)
-		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+		l.next = b.node(r)
 		l.next.value = v
 		return true
 	}
 
-	return l.next.push(v, r)
+	return l.next.push(v, b, r)
 }
 
-func (l *list) valueShift() {
-	if l.next != nil && l.next.value != 0 {
-		l.value = l.next.value
-		l.next.valueShift()
-	} else {
-		l.value = 0
+// remove takes v out of the chain that starts at l. The head of the chain stays
+// in its bucket and takes over the value of its successor instead, any other
+// node is unlinked. It returns the node it unlinked, if any.
+func (l *list) remove(v int) (bool, *list) {
+	if l.value == v {
+		n := l.next
+		if n == nil {
+			l.value = 0
+		} else {
+			l.value, l.next = n.value, n.next
+		}
+		return true, n
 	}
-}
-
-func (l *list) remove(v int) bool {
-	if l.value != v {
-		if l.next == nil {
-			return false
+	for prev, e := l, l.next; e != nil; prev, e = e, e.next {
+		if e.value == v {
+			prev.next = e.next
+			return true, e
 		}
-		return l.next.remove(v)
 	}
-	l.valueShift()
-	return true
+	return false, nil
 }
 
 type bucket struct {
-	store    *list
+	store *list
+	// Nodes unlinked by removes, which inserts reuse since a region cannot
+	// free single objects. Only the goroutine of the bucket touches them.
+	free     *list
 	requests chan request
 	done     chan bool
 }
 
 type FineGrainedMap struct {
-	buckets [HashCap]*bucket
+	buckets []*bucket
 	size    int
+	// Values inserted minus values deleted, only counted with Verify
+	values atomic.Int64
+}
+
+func (b *bucket) add(value int, r *region.Region) bool {
+	return b.store.push(value, b, r)
 }
 
-func (b bucket) add(value int, r *region.Region) bool {
-	return b.store.push(value, r)
+// node returns a node unlinked by an earlier remove, or a new one from r.
+func (b *bucket) node(r *region.Region) *list {
+	if n := b.free; n != nil {
+		b.free = n.next
+		n.next = nil
+		return n
+	}
+	allocationTimeStart := time.Now()
+	n := region.AllocFromRegion[list](r)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+	return n
 }
 
 func (b bucket) search(value int) bool {
@@ -76,13 +96,19 @@ func (b bucket) search(value int) bool {
 	return false
 }
 
-func (b bucket) remove(value int) bool {
-	return b.store.remove(value)
+func (b *bucket) remove(value int) bool {
+	ok, n := b.store.remove(value)
+	if n != nil {
+		n.value = 0
+		n.next = b.free
+		b.free = n
+	}
+	return ok
 }
 
 func NewFineGrainedMap(r *region.Region) *FineGrainedMap {
 	allocationTimeStart := time.Now()
-	buckets := region.AllocFromRegion[[HashCap]*bucket](r)
+	buckets := allocSlice[*bucket](HashCap, r)
 	fgm := region.AllocFromRegion[FineGrainedMap](r)
 	i := region.AllocFromRegion[int](r)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
@@ -90,23 +116,23 @@ func NewFineGrainedMap(r *region.Region) *FineGrainedMap {
 	for *i = 0; *i < HashCap; *i++ {
 		if r.IncRefCounter() {
 			allocationTimeStart = time.Now()
-			(*buckets)[*i] = region.AllocFromRegion[bucket](r)
-			(*buckets)[*i].store = region.AllocFromRegion[list](r)
-			(*buckets)[*i].requests = region.AllocChannel[request](0, r)
-			(*buckets)[*i].done = region.AllocChannel[bool](0, r)
+			buckets[*i] = region.AllocFromRegion[bucket](r)
+			buckets[*i].store = region.AllocFromRegion[list](r)
+			buckets[*i].requests = region.AllocChannel[request](0, r)
+			buckets[*i].done = region.AllocChannel[bool](0, r)
 			AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 			
-			go (*buckets)[*i].run(r)
+			go buckets[*i].run(r)
 		}
 	}
 
-	fgm.buckets = *buckets
+	fgm.buckets = buckets
 	fgm.size = HashCap
 
 	return fgm
 }
 
-func (b bucket) run(r *region.Region) {
+func (b *bucket) run(r *region.Region) {
 	allocationTimeStart := time.Now()
 	req := region.AllocFromRegion[request](r)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
@@ -152,6 +178,31 @@ func (m *FineGrainedMap) Delete(value int, idx int, res chan bool) bool {
 	return <-res
 }
 
+// validate checks that every value is stored once, in the bucket of its hash,
+// and that the map holds the values that were inserted and not deleted. It
+// fails the run otherwise.
+func (m *FineGrainedMap) validate() {
+	count := 0
+	for i, b := range m.buckets {
+		for e := b.store; e != nil && e.value != 0; e = e.next {
+			if m.hashKey(e.value) != i {
+				Fail("hash-map: %d is in bucket %d instead of %d", e.value, i, m.hashKey(e.value))
+				return
+			}
+			for d := e.next; d != nil && d.value != 0; d = d.next {
+				if d.value == e.value {
+					Fail("hash-map: %d is stored twice", e.value)
+					return
+				}
+			}
+			count++
+		}
+	}
+	if int64(count) != m.values.Load() {
+		Fail("hash-map: holds %d values, expected %d", count, m.values.Load())
+	}
+}
+
 func closeBuckets(m *FineGrainedMap) {
 	for i := range m.buckets {
 		close(m.buckets[i].requests)
@@ -159,7 +210,7 @@ func closeBuckets(m *FineGrainedMap) {
 	}
 }
 
-func generateHashMapOperations(m *FineGrainedMap, valueRange int, op int, done chan bool, r *region.Region) {
+func generateHashMapOperations(id int, m *FineGrainedMap, valueRange int, op int, done chan bool, r *region.Region) {
 	r2 := region.CreateRegion(0)
 
 	allocationTimeStart := time.Now()
@@ -167,20 +218,28 @@ func generateHashMapOperations(m *FineGrainedMap, valueRange int, op int, done c
 	res := region.AllocChannel[bool](0, r2)
 	req := region.AllocFromRegion[request](r2)
 	i := region.AllocFromRegion[int](r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	keys := region.AllocFromRegion[KeyGenerator](r2)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+	keys.Init(HashKeys, valueRange, HashRange*Goroutines, rng)
+
 	for *i = 0; *i < op; *i++ {
-		m.Insert(*i + valueRange, *idx, res, *req)
-		/*
-		val := rand.IntN(valueRange) + 1
-		switch method := opType(rand.IntN(3)); method {
+		switch opType(HashMix.Pick(rng)) {
 		case OpInsert:
-			m.Insert(val, *idx, res)
+			if m.Insert(keys.Insert(), *idx, res, *req) && Verify {
+				m.values.Add(1)
+			}
 		case OpSearch:
-			m.Search(val, *idx, res)
+			m.Search(keys.Existing(), *idx, res)
 		case OpRemove:
-			m.Delete(val, *idx, res)
-		}*/
+			if m.Delete(keys.Existing(), *idx, res) && Verify {
+				m.values.Add(-1)
+			}
+		}
 	}
 
 	deallocationStart := time.Now()
@@ -192,7 +251,7 @@ func generateHashMapOperations(m *FineGrainedMap, valueRange int, op int, done c
 }
 
 func RunHashMap() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -211,7 +270,7 @@ func RunHashMap() SystemMetrics {
 	valueRange := 0
 	for i := 0; i < Goroutines; i++ {
 		if r1.IncRefCounter() {
-			go generateHashMapOperations(m, valueRange, HashOp, done, r1)
+			go generateHashMapOperations(i, m, valueRange, HashOp, done, r1)
 		}
 		valueRange += HashOp
 	}
@@ -220,13 +279,20 @@ func RunHashMap() SystemMetrics {
 		<-done
 	}
 
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		m.validate()
+		verification = time.Since(verificationStart)
+	}
+
 	closeBuckets(m)
 
 	deallocationStart := time.Now()
 	r1.RemoveRegion()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
 
 	runtime.GC()
 
@@ -0,0 +1,176 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	"bytes"
+	"encoding/json"
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+type httpRequest struct {
+	ID     int
+	Values []int
+}
+
+type httpResponse struct {
+	ID    int
+	Sum   int
+	Count int
+}
+
+// An exchange holds everything a handler allocates for one request.
+type exchange struct {
+	in  httpRequest
+	out httpResponse
+}
+
+// handleSum answers a request with the sum of its values. The exchange lives in
+// a region of the request, removed once the response is written.
+func handleSum(w http.ResponseWriter, r *http.Request) {
+	r1 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	ex := region.AllocFromRegion[exchange](r1)
+	ex.in.Values = allocSlice[int](HTTPValues, r1)[:0]
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	if err := json.NewDecoder(r.Body).Decode(&ex.in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		removeRegion(r1)
+		return
+	}
+
+	ex.out.ID = ex.in.ID
+	ex.out.Count = len(ex.in.Values)
+	for _, v := range ex.in.Values {
+		ex.out.Sum += v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&ex.out)
+
+	removeRegion(r1)
+}
+
+func removeRegion(r *region.Region) {
+	deallocationStart := time.Now()
+	r.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+}
+
+// sendHTTPRequests posts op requests of HTTPValues values and checks the sums
+// in the responses. The client keeps its connection alive between requests.
+func sendHTTPRequests(id int, op int, client *http.Client, url string, done chan bool, r1 *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	req := region.AllocFromRegion[httpRequest](r2)
+	req.Values = allocSlice[int](HTTPValues, r2)
+	resp := region.AllocFromRegion[httpResponse](r2)
+	body := region.AllocFromRegion[bytes.Buffer](r2)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	for i := region.AllocFromRegion[int](r2); *i < op; *i++ {
+		req.ID = id*op + *i
+		sum := 0
+		for j := range req.Values {
+			req.Values[j] = req.ID + j
+			sum += req.Values[j]
+		}
+
+		body.Reset()
+		json.NewEncoder(body).Encode(req)
+
+		latencyStart := time.Now()
+		res, err := client.Post(url, "application/json", body)
+		if err != nil {
+			Fail("http: %v", err)
+			break
+		}
+		err = json.NewDecoder(res.Body).Decode(resp)
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		if err != nil {
+			Fail("http: %v", err)
+			break
+		}
+		if resp.ID != req.ID || resp.Sum != sum || resp.Count != HTTPValues {
+			Fail("http: request %d answered as %d with sum %d of %d values, expected sum %d of %d", req.ID, resp.ID, resp.Sum, resp.Count, sum, HTTPValues)
+		}
+	}
+
+	removeRegion(r2)
+
+	r1.DecRefCounter()
+	done <- true
+}
+
+func RunHTTPServer() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		Fail("http: %v", err)
+		r1.RemoveRegion()
+		return SystemMetrics{}
+	}
+
+	allocationTimeStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sum", handleSum)
+	server := &http.Server{Handler: mux}
+	transport := &http.Transport{MaxIdleConnsPerHost: Goroutines}
+	client := &http.Client{Transport: transport}
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String() + "/sum"
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go sendHTTPRequests(i, HTTPOp, client, url, done, r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	transport.CloseIdleConnections()
+	if server.Close() != nil {
+		fmt.Println("Could not stop server")
+	}
+
+	removeRegion(r1)
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(HTTPOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,304 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// An lruEntry is both on the recency list of its shard and in a hash chain of
+// its buckets. Every entry lives in its own region, which is removed when the
+// entry is evicted.
+type lruEntry struct {
+	key   int
+	value []byte
+	prev  *lruEntry
+	next  *lruEntry
+	chain *lruEntry
+	r     *region.Region
+}
+
+// An lruShard holds at most LRUCapacity entries, head.next is the most recently
+// used one and head.prev the one to evict next.
+type lruShard struct {
+	mu      sync.Mutex
+	buckets []*lruEntry
+	head    lruEntry
+	size    int
+}
+
+// An LRUCache spreads its keys over LRUShards shards, each with its own lock.
+type LRUCache struct {
+	shards []lruShard
+}
+
+func NewLRUCache(r *region.Region) *LRUCache {
+	allocationTimeStart := time.Now()
+	c := region.AllocFromRegion[LRUCache](r)
+	c.shards = allocSlice[lruShard](LRUShards, r)
+	for i := range c.shards {
+		c.shards[i].buckets = allocSlice[*lruEntry](LRUCapacity, r)
+	}
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	for i := range c.shards {
+		c.shards[i].head.prev = &c.shards[i].head
+		c.shards[i].head.next = &c.shards[i].head
+	}
+	return c
+}
+
+func (c *LRUCache) shard(key int) *lruShard {
+	return &c.shards[key%LRUShards]
+}
+
+func (s *lruShard) bucket(key int) **lruEntry {
+	return &s.buckets[key/LRUShards%LRUCapacity]
+}
+
+func (s *lruShard) find(key int) *lruEntry {
+	for e := *s.bucket(key); e != nil; e = e.chain {
+		if e.key == key {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *lruShard) pushFront(e *lruEntry) {
+	e.prev = &s.head
+	e.next = s.head.next
+	s.head.next.prev = e
+	s.head.next = e
+}
+
+func (s *lruShard) unlink(e *lruEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+// evict removes the least recently used entry of s together with its region.
+func (s *lruShard) evict() {
+	e := s.head.prev
+	s.unlink(e)
+	for p := s.bucket(e.key); *p != nil; p = &(*p).chain {
+		if *p == e {
+			*p = e.chain
+			break
+		}
+	}
+	s.size--
+
+	deallocationStart := time.Now()
+	e.r.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+}
+
+// clear removes the regions of all entries of the cache.
+func (c *LRUCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		for s.size > 0 {
+			s.evict()
+		}
+	}
+}
+
+// Get reports whether key is cached and makes it the most recently used entry
+// of its shard. The value is read under the lock of the shard, as it may be
+// evicted as soon as the lock is released.
+func (c *LRUCache) Get(key int) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.find(key)
+	if e == nil {
+		return false
+	}
+	s.unlink(e)
+	s.pushFront(e)
+
+	sum := 0
+	for _, b := range e.value {
+		sum += int(b)
+	}
+	if Verify && sum != len(e.value)*int(byte(key)) {
+		Fail("lru-cache: value of key %d was overwritten", key)
+	}
+	return true
+}
+
+// Put caches a value of size bytes for key, evicting the least recently used
+// entry of its shard when the shard is full.
+func (c *LRUCache) Put(key int, size int) {
+	r := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	e := region.AllocFromRegion[lruEntry](r)
+	e.value = allocSlice[byte](size, r)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	e.r = r
+	e.key = key
+	for i := range e.value {
+		e.value[i] = byte(key)
+	}
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another goroutine cached the key after our miss
+	if s.find(key) != nil {
+		deallocationStart := time.Now()
+		r.RemoveRegion()
+		DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+		return
+	}
+	if s.size == LRUCapacity {
+		s.evict()
+	}
+	b := s.bucket(key)
+	e.chain = *b
+	*b = e
+	s.pushFront(e)
+	s.size++
+}
+
+// validate checks that every shard holds at most LRUCapacity entries, that the
+// recency list and the hash chains hold the same entries and that every value
+// still has its size and contents.
+func (c *LRUCache) validate() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		count := 0
+		for e := s.head.next; e != &s.head; e = e.next {
+			count++
+			if s.find(e.key) != e {
+				Fail("lru-cache: key %d is listed but not hashed in shard %d", e.key, i)
+				return
+			}
+			if len(e.value) < LRUValueMin || len(e.value) > LRUValueMax {
+				Fail("lru-cache: value of key %d has %d bytes", e.key, len(e.value))
+				return
+			}
+		}
+		hashed := 0
+		for _, e := range s.buckets {
+			for ; e != nil; e = e.chain {
+				hashed++
+			}
+		}
+		if count != s.size || hashed != s.size || s.size > LRUCapacity {
+			Fail("lru-cache: shard %d lists %d and hashes %d entries, expected %d of at most %d", i, count, hashed, s.size, LRUCapacity)
+			return
+		}
+	}
+}
+
+// hotKeys is the amount of keys that fit in the cache with room to spare, gets
+// of a hot key mostly hit.
+func hotKeys() int {
+	return max(LRUShards*LRUCapacity/2, 1)
+}
+
+func generateLRUCacheOperations(id int, c *LRUCache, op int, done chan bool, r *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	i := region.AllocFromRegion[int](r2)
+	cold := region.AllocFromRegion[int](r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+
+	// Cold keys are never cached before, every goroutine has its own
+	*cold = hotKeys() + 1 + id
+
+	for *i = 0; *i < op; *i++ {
+		latencyStart := time.Now()
+
+		key := 1 + rng.IntN(hotKeys())
+		if rng.IntN(100) >= LRUHitRatio {
+			key = *cold
+			*cold += Goroutines
+		}
+		if !c.Get(key) && rng.IntN(100) < LRUEvictRate {
+			c.Put(key, LRUValueMin+rng.IntN(LRUValueMax-LRUValueMin+1))
+		}
+
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+	}
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r.DecRefCounter()
+	done <- true
+}
+
+func RunLRUCache() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	cache := NewLRUCache(r1)
+	for key := 1; key <= hotKeys(); key++ {
+		cache.Put(key, LRUValueMin)
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go generateLRUCacheOperations(i, cache, LRUOp, done, r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		cache.validate()
+		verification = time.Since(verificationStart)
+	}
+
+	cache.clear()
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(LRUOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -22,31 +22,41 @@ type position struct {
 	latencyStart time.Time
 }
 
-func generateMatrix(valueRange int, r *region.Region) [Rows]*[Cols]*int {
+// generateMatrix returns a matrix of values from [1, valueRange], drawn from
+// stream id of the seed, so both memory managers multiply the same matrices.
+func generateMatrix(id int, valueRange int, r *region.Region) []*[]*int {
 	allocationStart := time.Now()
-	matrix := region.AllocFromRegion[[Rows]*[Cols]*int](r)
+	matrix := allocSlice[*[]*int](Rows, r)
 	i := region.AllocFromRegion[int](r)
 	j := region.AllocFromRegion[int](r)
+	pcg := region.AllocFromRegion[rand.PCG](r)
+	rng := region.AllocFromRegion[rand.Rand](r)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+
 	for *i = 0; *i < Rows; *i++ {
 		allocationStart = time.Now()
-		(*matrix)[*i] = region.AllocFromRegion[[Cols]*int](r)
+		matrix[*i] = region.AllocFromRegion[[]*int](r)
+		*matrix[*i] = allocSlice[*int](Cols, r)
 		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 		for *j = 0; *j < Cols; *j++ {
 			allocationStart = time.Now()
-			(*matrix)[*i][*j] = region.AllocFromRegion[int](r)
+			(*matrix[*i])[*j] = region.AllocFromRegion[int](r)
 			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
-			*(*matrix)[*i][*j] = rand.IntN(valueRange) + 1
+			*(*matrix[*i])[*j] = rng.IntN(valueRange) + 1
 		}
 	}
 
-	return *matrix
+	return matrix
 }
 
-func matrixMultiplication(m1 [Rows]*[Cols]*int, m2 [Rows]*[Cols]*int, done chan bool, r1 *region.Region) {
+// matrixMultiplication multiplies m1 and m2 and returns the time spent verifying
+// the result, which does not count as computation.
+func matrixMultiplication(m1 []*[]*int, m2 []*[]*int, done chan bool, r1 *region.Region) time.Duration {
 	if Cols != Rows {
-		return
+		return 0
 	}
 
 	sz := (1 + Rows) * Cols * 8
@@ -57,7 +67,7 @@ func matrixMultiplication(m1 [Rows]*[Cols]*int, m2 [Rows]*[Cols]*int, done chan
 	r2 := region.CreateRegion(sz)
 
 	allocationStart := time.Now()
-	result := region.AllocFromRegion[[Rows]*[Cols]int](r2)
+	result := allocSlice[*[]int](Rows, r2)
 	products := region.AllocChannel[product](0, r1)
 	positions := region.AllocChannel[position](0, r1)
 	i := region.AllocFromRegion[int](r1)
@@ -71,7 +81,8 @@ func matrixMultiplication(m1 [Rows]*[Cols]*int, m2 [Rows]*[Cols]*int, done chan
 
 	allocationStart = time.Now()
 	for *i = 0; *i < Rows; *i++ {
-		(*result)[*i] = region.AllocFromRegion[[Cols]int](r2)
+		result[*i] = region.AllocFromRegion[[]int](r2)
+		*result[*i] = allocSlice[int](Cols, r2)
 	}
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
@@ -93,18 +104,44 @@ func matrixMultiplication(m1 [Rows]*[Cols]*int, m2 [Rows]*[Cols]*int, done chan
 
 	for *i = 0; *i < (Rows)*(Cols); *i++ {
 		r := <-products
-		(*result)[r.pos.x][r.pos.y] = r.res
+		(*result[r.pos.x])[r.pos.y] = r.res
 	}
 
 	close(positions)
 	<-done
 
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		verifyProduct(m1, m2, result)
+		verification = time.Since(verificationStart)
+	}
+
 	deallocationStart := time.Now()
 	r2.RemoveRegion()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	return verification
+}
+
+// verifyProduct recomputes the product of m1 and m2 on a single goroutine and
+// fails the run if result differs from it.
+func verifyProduct(m1 []*[]*int, m2 []*[]*int, result []*[]int) {
+	for i := range m1 {
+		for j := range *result[i] {
+			expected := 0
+			for k := range m2 {
+				expected += *(*m1[i])[k] * *(*m2[k])[j]
+			}
+			if got := (*result[i])[j]; got != expected {
+				Fail("mat-mul: result[%d][%d] is %d, expected %d", i, j, got, expected)
+				return
+			}
+		}
+	}
 }
 
-func calculateProduct(row [Cols]*int, col [Rows]*int, k *int, p *int) *int {
+func calculateProduct(row []*int, col []*int, k *int, p *int) *int {
 	*p = 0
 	for *k = 0; *k < len(row); *k++ {
 		*p += (*row[*k]) * (*col[*k])
@@ -112,24 +149,24 @@ func calculateProduct(row [Cols]*int, col [Rows]*int, k *int, p *int) *int {
 	return p
 }
 
-func fetchColumn(m2 [Rows]*[Cols]*int, col [Rows]*int, j int, i *int) [Rows]*int {
+func fetchColumn(m2 []*[]*int, col []*int, j int, i *int) []*int {
 	for *i = 0; *i < len(m2); *i++ {
-		*col[*i] = *m2[*i][j]
+		*col[*i] = *(*m2[*i])[j]
 	}
 	return col
 }
 
-func initColumn(col *[Rows]*int, n int, i *int, r *region.Region) {
+func initColumn(col []*int, n int, i *int, r *region.Region) {
 	allocationStart := time.Now()
 	for *i = 0; *i < n; *i++ {
-		(*col)[*i] = region.AllocFromRegion[int](r)
+		col[*i] = region.AllocFromRegion[int](r)
 	}
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 }
 
 func calculateProducts(
-	m1 [Rows]*[Cols]*int,
-	m2 [Rows]*[Cols]*int,
+	m1 []*[]*int,
+	m2 []*[]*int,
 	products chan product,
 	positions chan position,
 	done chan bool,
@@ -138,7 +175,7 @@ func calculateProducts(
 	r2 := region.CreateRegion(Rows * 16)
 
 	allocationStart := time.Now()
-	col := region.AllocFromRegion[[Rows]*int](r2)
+	col := allocSlice[*int](Rows, r2)
 	pos := region.AllocFromRegion[position](r2)
 	i := region.AllocFromRegion[int](r2)
 	p := region.AllocFromRegion[int](r2)
@@ -149,10 +186,10 @@ func calculateProducts(
 	for *pos = range positions {
 		Latency.Add(time.Since(pos.latencyStart).Nanoseconds())
 
-		fetchColumn(m2, *col, pos.y, i)
+		fetchColumn(m2, col, pos.y, i)
 
 		products <- product{
-			res: *calculateProduct(*m1[pos.x], *col, i, p),
+			res: *calculateProduct(*m1[pos.x], col, i, p),
 			pos: *pos,
 		}
 	}
@@ -166,7 +203,7 @@ func calculateProducts(
 }
 
 func RunMatrixMultiplication(valueRange int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 	AllocationTime.Store(0)
 	DeallocationTime.Store(0)
 	Latency.Store(0)
@@ -182,9 +219,9 @@ func RunMatrixMultiplication(valueRange int) SystemMetrics {
 	done := region.AllocChannel[bool](0, r1)
 	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
 
-	m1 := generateMatrix(valueRange, r1)
-	m2 := generateMatrix(valueRange, r1)
-	matrixMultiplication(m1, m2, done, r1)
+	m1 := generateMatrix(0, valueRange, r1)
+	m2 := generateMatrix(1, valueRange, r1)
+	verification := matrixMultiplication(m1, m2, done, r1)
 
 	for i := 0; i < Goroutines; i++ {
 		<-done
@@ -194,7 +231,7 @@ func RunMatrixMultiplication(valueRange int) SystemMetrics {
 	r1.RemoveRegion()
 	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 
-	computationTime := float64(time.Since(start).Nanoseconds())
+	computationTime := float64((time.Since(start) - verification).Nanoseconds())
 
 	runtime.GC()
 
@@ -0,0 +1,148 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A taskObject is allocated by a request or one of its sub-tasks.
+type taskObject struct {
+	value int
+	next  *taskObject
+	buf   [48]byte
+}
+
+// runTask runs a task of a request in a region of its own. It allocates
+// NestedObjects objects, runs NestedFanout sub-tasks until NestedDepth and
+// hands its result to parent, the region of the task that started it, before
+// its own region is removed.
+func runTask(level int, id int, parent *region.Region) int {
+	r := region.CreateRegion(0)
+
+	var head *taskObject
+	for i := 0; i < NestedObjects; i++ {
+		allocationStart := time.Now()
+		o := region.AllocFromRegion[taskObject](r)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		o.value = id + i
+		o.next = head
+		head = o
+	}
+
+	sum := 0
+	for o := head; o != nil; o = o.next {
+		sum += o.value
+	}
+	if level < NestedDepth {
+		for f := 0; f < NestedFanout; f++ {
+			sum += runTask(level+1, id*NestedFanout+f, r)
+		}
+	}
+
+	allocationStart := time.Now()
+	result := region.AllocFromRegion[taskObject](parent)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+	result.value = sum
+
+	deallocationStart := time.Now()
+	r.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	return result.value
+}
+
+// expectedTask is the result of runTask, computed without allocating.
+func expectedTask(level int, id int) int {
+	sum := NestedObjects*id + NestedObjects*(NestedObjects-1)/2
+	if level < NestedDepth {
+		for f := 0; f < NestedFanout; f++ {
+			sum += expectedTask(level+1, id*NestedFanout+f)
+		}
+	}
+	return sum
+}
+
+func serveNestedRequests(id int, total *int, done chan bool, r1 *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	i := region.AllocFromRegion[int](r2)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for *i = 0; *i < NestedRequests; *i++ {
+		latencyStart := time.Now()
+		*total += runTask(0, id*NestedRequests+*i, r2)
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+	}
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r1.DecRefCounter()
+	done <- true
+}
+
+func RunNestedRegions() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	totals := allocSlice[int](Goroutines, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go serveNestedRequests(i, &totals[i], done, r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	var verification time.Duration
+	if Verify {
+		verificationStart := time.Now()
+		for i := range totals {
+			expected := 0
+			for n := 0; n < NestedRequests; n++ {
+				expected += expectedTask(0, i*NestedRequests+n)
+			}
+			if totals[i] != expected {
+				Fail("nested-regions: requests of goroutine %d summed to %d, expected %d", i, totals[i], expected)
+				break
+			}
+		}
+		verification = time.Since(verificationStart)
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store((time.Since(computationTimeStart) - verification).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(NestedRequests*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,172 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A batch of records travels through the stages of the pipeline. Everything the
+// stages allocate for it lives in its own region, which is handed from stage to
+// stage with the batch and removed by the last one.
+type batch struct {
+	records      []*record
+	r            *region.Region
+	latencyStart time.Time
+}
+
+// A record is allocated anew by every stage, from the record of the stage before.
+type record struct {
+	raw    [64]byte
+	fields [8]int
+}
+
+// parse is the first stage. It reads PipelineOp raw records, parses their fields
+// and sends them on in batches of PipelineBatch.
+func parse(id int, out chan *batch, done chan bool, r1 *region.Region) {
+	for i := region.AllocFromRegion[int](r1); *i < PipelineOp; *i += PipelineBatch {
+		r2 := region.CreateRegion(0)
+
+		allocationStart := time.Now()
+		b := region.AllocFromRegion[batch](r2)
+		b.records = allocSlice[*record](min(PipelineBatch, PipelineOp-*i), r2)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		b.r = r2
+		b.latencyStart = time.Now()
+		for j := range b.records {
+			allocationStart = time.Now()
+			rec := region.AllocFromRegion[record](r2)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+			for k := range rec.raw {
+				rec.raw[k] = byte(id + *i + j + k)
+			}
+			for k := range rec.raw {
+				rec.fields[k/8] += int(rec.raw[k])
+			}
+			b.records[j] = rec
+		}
+		out <- b
+	}
+	r1.DecRefCounter()
+	done <- true
+}
+
+// transform is a middle stage, it replaces every record of a batch by a new one.
+func transform(stage int, in chan *batch, out chan *batch, done chan bool, r1 *region.Region) {
+	for b := range in {
+		for j, prev := range b.records {
+			allocationStart := time.Now()
+			rec := region.AllocFromRegion[record](b.r)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+			rec.raw = prev.raw
+			for k := range rec.fields {
+				rec.fields[k] = prev.fields[k]*stage + k
+			}
+			b.records[j] = rec
+		}
+		out <- b
+	}
+	r1.DecRefCounter()
+	done <- true
+}
+
+// aggregate is the last stage, it sums the fields of the records and removes
+// the regions of the batches.
+func aggregate(in chan *batch, done chan bool, r1 *region.Region) {
+	allocationStart := time.Now()
+	sum := region.AllocFromRegion[int](r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for b := range in {
+		for _, rec := range b.records {
+			for _, f := range rec.fields {
+				*sum += f
+			}
+		}
+		Latency.Add(time.Since(b.latencyStart).Nanoseconds())
+
+		deallocationStart := time.Now()
+		b.r.RemoveRegion()
+		DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+	}
+	r1.DecRefCounter()
+	done <- true
+}
+
+// closeStage closes the output of a stage once its goroutines are done.
+func closeStage(out chan *batch, done chan bool, r1 *region.Region) {
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+	close(out)
+	r1.DecRefCounter()
+}
+
+func RunPipeline() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	// links[s] connects stage s to stage s+1
+	links := allocSlice[chan *batch](PipelineStages-1, r1)
+	dones := allocSlice[chan bool](PipelineStages-1, r1)
+	for s := range links {
+		links[s] = region.AllocChannel[*batch](Goroutines, r1)
+		dones[s] = region.AllocChannel[bool](0, r1)
+	}
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	last := PipelineStages - 1
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go parse(i, links[0], dones[0], r1)
+		}
+		for s := 1; s < last; s++ {
+			if r1.IncRefCounter() {
+				go transform(s, links[s-1], links[s], dones[s], r1)
+			}
+		}
+		if r1.IncRefCounter() {
+			go aggregate(links[last-1], done, r1)
+		}
+	}
+	for s := range links {
+		if r1.IncRefCounter() {
+			go closeStage(links[s], dones[s], r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(PipelineOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
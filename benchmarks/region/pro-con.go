@@ -44,7 +44,7 @@ func consuming(buffer chan value, done chan bool, r *region.Region) {
 }
 
 func RunProducerConsumer(valueRange int) SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
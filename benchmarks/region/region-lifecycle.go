@@ -0,0 +1,117 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// lifecycleObjects are linked into a list, so a region holds a pointer graph.
+type lifecycleObject struct {
+	next *lifecycleObject
+	buf  [56]byte
+}
+
+// fillRegion allocates n objects from r.
+func fillRegion(r *region.Region, n int) {
+	var head *lifecycleObject
+	for i := 0; i < n; i++ {
+		allocationStart := time.Now()
+		o := region.AllocFromRegion[lifecycleObject](r)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		o.next = head
+		head = o
+	}
+}
+
+// shareRegion fills r, which it shares with the other goroutines of a cycle,
+// and gives up its reference to it.
+func shareRegion(r *region.Region, n int, done chan bool) {
+	fillRegion(r, n)
+
+	decRefStart := time.Now()
+	r.DecRefCounter()
+	DecRefLatency.Record(time.Since(decRefStart).Nanoseconds())
+
+	done <- true
+}
+
+// RunRegionLifecycle creates and removes depth nested regions of initial size
+// bytes LifecycleCycles times. The outermost region is shared by Goroutines
+// goroutines through its reference counter, each allocating objects objects
+// from it, and every inner region holds objects objects. Every create, remove,
+// increment and decrement is recorded in its latency histogram.
+func RunRegionLifecycle(size int, objects int, depth int) SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	// r1 outlives every cycle, so the goroutines do not hold references to it
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	regions := allocSlice[*region.Region](depth, r1)
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for c := 0; c < LifecycleCycles; c++ {
+		latencyStart := time.Now()
+
+		for d := range regions {
+			createStart := time.Now()
+			regions[d] = region.CreateRegion(size)
+			CreateLatency.Record(time.Since(createStart).Nanoseconds())
+		}
+
+		shared := 0
+		for g := 0; g < Goroutines; g++ {
+			incRefStart := time.Now()
+			ok := regions[0].IncRefCounter()
+			IncRefLatency.Record(time.Since(incRefStart).Nanoseconds())
+			if ok {
+				go shareRegion(regions[0], objects, done)
+				shared++
+			}
+		}
+		for d := 1; d < depth; d++ {
+			fillRegion(regions[d], objects)
+		}
+		for g := 0; g < shared; g++ {
+			<-done
+		}
+
+		for d := depth - 1; d >= 0; d-- {
+			removeStart := time.Now()
+			regions[d].RemoveRegion()
+			remove := time.Since(removeStart).Nanoseconds()
+			RemoveLatency.Record(remove)
+			DeallocationTime.Add(remove)
+		}
+
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(LifecycleCycles*depth) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,235 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A table is one generation of the buckets of a ResizableMap. Its buckets, their
+// goroutines and their chains live in a region of their own, which is removed
+// once the next generation has taken over the values.
+type table struct {
+	buckets    []*bucket
+	size       int
+	generation int
+	r          *region.Region
+}
+
+// A ResizableMap starts with HashInitCap buckets and doubles them whenever the
+// map holds more than HashLoadFactor values per bucket. Every request holds the
+// read lock of mu until it is answered and growing holds the write lock: a
+// bucket goroutine cannot hand a request on to the next generation, so the
+// table may only be swapped once no request is in flight. Growth therefore
+// stops the whole map, unlike the lock-free requests of hash-map.
+type ResizableMap struct {
+	mu    sync.RWMutex
+	table *table
+	count atomic.Int64
+}
+
+func newTable(size int, generation int) *table {
+	r := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	t := region.AllocFromRegion[table](r)
+	t.buckets = allocSlice[*bucket](size, r)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	t.size = size
+	t.generation = generation
+	t.r = r
+
+	for i := 0; i < size; i++ {
+		allocationTimeStart = time.Now()
+		t.buckets[i] = region.AllocFromRegion[bucket](r)
+		t.buckets[i].store = region.AllocFromRegion[list](r)
+		t.buckets[i].requests = region.AllocChannel[request](0, r)
+		t.buckets[i].done = region.AllocChannel[bool](0, r)
+		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+	}
+	return t
+}
+
+// start runs the goroutines of the buckets of t.
+func (t *table) start() {
+	for i := 0; i < t.size; i++ {
+		if t.r.IncRefCounter() {
+			go t.buckets[i].run(t.r)
+		}
+	}
+}
+
+// retire stops the goroutines of the buckets of t and removes its region.
+func (t *table) retire() {
+	for i := 0; i < t.size; i++ {
+		close(t.buckets[i].requests)
+		<-t.buckets[i].done
+	}
+
+	deallocationStart := time.Now()
+	t.r.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+}
+
+func NewResizableMap(r *region.Region) *ResizableMap {
+	allocationTimeStart := time.Now()
+	m := region.AllocFromRegion[ResizableMap](r)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	m.table = newTable(HashInitCap, 0)
+	m.table.start()
+	return m
+}
+
+// grow doubles the buckets of generation, unless another goroutine already did.
+// The values are rehashed into the buckets of the next generation before its
+// goroutines start, so no request can see a half migrated table.
+func (m *ResizableMap) grow(generation int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.table
+	if old.generation != generation || m.count.Load() <= int64(old.size*HashLoadFactor) {
+		return
+	}
+
+	t := newTable(old.size*2, generation+1)
+	for i := 0; i < old.size; i++ {
+		for e := old.buckets[i].store; e != nil && e.value != 0; e = e.next {
+			t.buckets[e.value%t.size].add(e.value, t.r)
+		}
+	}
+	t.start()
+
+	m.table = t
+	old.retire()
+}
+
+// send hands a request to the bucket of its value and returns the result
+// together with the generation and size of the table that handled it.
+func (m *ResizableMap) send(req request) (bool, int, int) {
+	m.mu.RLock()
+	t := m.table
+	generation, size := t.generation, t.size
+	t.buckets[req.value%size].requests <- req
+	ok := <-req.result
+	m.mu.RUnlock()
+
+	return ok, generation, size
+}
+
+func (m *ResizableMap) Insert(value int, res chan bool, req request) bool {
+	req.value = value
+	req.op = OpInsert
+	req.result = res
+	req.latencyStart = time.Now()
+
+	ok, generation, size := m.send(req)
+	if ok && m.count.Add(1) > int64(size*HashLoadFactor) {
+		m.grow(generation)
+	}
+	return ok
+}
+
+func (m *ResizableMap) Search(value int, res chan bool) bool {
+	ok, _, _ := m.send(request{value: value, op: OpSearch, result: res, latencyStart: time.Now()})
+	return ok
+}
+
+func (m *ResizableMap) Delete(value int, res chan bool) bool {
+	ok, _, _ := m.send(request{value: value, op: OpRemove, result: res, latencyStart: time.Now()})
+	if ok {
+		m.count.Add(-1)
+	}
+	return ok
+}
+
+func generateResizableHashMapOperations(id int, m *ResizableMap, valueRange int, op int, done chan bool, r *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	res := region.AllocChannel[bool](0, r2)
+	req := region.AllocFromRegion[request](r2)
+	i := region.AllocFromRegion[int](r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	keys := region.AllocFromRegion[KeyGenerator](r2)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+	keys.Init(HashKeys, valueRange, HashRange*Goroutines, rng)
+
+	for *i = 0; *i < op; *i++ {
+		switch opType(HashMix.Pick(rng)) {
+		case OpInsert:
+			m.Insert(keys.Insert(), res, *req)
+		case OpSearch:
+			m.Search(keys.Existing(), res)
+		case OpRemove:
+			m.Delete(keys.Existing(), res)
+		}
+	}
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r.DecRefCounter()
+	done <- true
+}
+
+func RunResizableHashMap() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationTimeStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	m := NewResizableMap(r1)
+
+	valueRange := 0
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go generateResizableHashMapOperations(i, m, valueRange, HashOp, done, r1)
+		}
+		valueRange += HashOp
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	m.table.retire()
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(HashOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -3,40 +3,62 @@
 package region
 
 import (
+	"encoding/binary"
 	. "experiments/benchmarks/metrics"
 	"fmt"
+	"io"
 	"net"
 	"region"
 	"runtime"
 	"runtime/debug"
+	"sync"
 	"time"
 )
 
 type Request struct {
 	conn         net.Conn
 	latencyStart time.Time
-	buf          [1024]byte
+	header       [4]byte
+	buf          [ServHandMaxPayload]byte
+}
+
+// A Response is allocated by the server for every request it reads.
+type Response struct {
+	header [4]byte
+	// Checksum of the payload followed by the payload
+	buf [4 + ServHandMaxPayload]byte
 }
 
 type server struct {
 	requests chan Request
 	listener net.Listener
+	closed   sync.Once
+	closeErr error
 }
 
-func newServer(address string, r *region.Region) (*server, error) {
+// newServer listens on network, see Listen.
+func newServer(network string, r *region.Region) (*server, error) {
 	allocationTimeStart := time.Now()
 	s := region.AllocFromRegion[server](r)
 	s.requests = region.AllocChannel[Request](0, r)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
-	s.listener, _ = net.Listen("tcp", address)
+	var err error
+	if s.listener, err = Listen(network); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
 
+// connections returns the amount of connections a client opens to send op requests.
+func connections(op int) int {
+	return (op + ServHandKeepAlive - 1) / ServHandKeepAlive
+}
+
 func (s *server) acceptConnections(done chan bool, r1 *region.Region) {
-	r2 := region.CreateRegion(ServHandOp * 1064 * Goroutines)
-	for i := region.AllocFromRegion[int](r2); *i < ServHandOp*Goroutines; *i++ {
+	r2 := region.CreateRegion(connections(ServHandOp) * 1072 * Goroutines)
+	for i := region.AllocFromRegion[int](r2); *i < connections(ServHandOp)*Goroutines; *i++ {
 		allocationTimeStart := time.Now()
 		req := region.AllocFromRegion[Request](r2)
 		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
@@ -48,7 +70,6 @@ func (s *server) acceptConnections(done chan bool, r1 *region.Region) {
 		}
 
 		req.conn = conn
-		req.latencyStart = time.Now()
 		s.requests <- *req
 	}
 
@@ -68,40 +89,124 @@ func (s *server) handleConnections(done chan bool, r1 *region.Region) {
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
 
 	for *req = range s.requests {
-		Latency.Add(time.Since(req.latencyStart).Nanoseconds())
-		s.handleConnection(*req)
+		s.handleConnection(req)
 	}
 	r1.DecRefCounter()
 	done <- true
 }
 
-func (s *server) handleConnection(req Request) {
+// handleConnection answers the requests of a connection until the client closes
+// it. The responses live in a region of the connection, removed when it closes.
+func (s *server) handleConnection(req *Request) {
+	r2 := region.CreateRegion(0)
+	for {
+		n, err := ReadMessage(req.conn, &req.header, req.buf[:])
+		if err != nil {
+			if err != io.EOF {
+				Fail("serv-hand: %v", err)
+			}
+			break
+		}
+
+		allocationTimeStart := time.Now()
+		resp := region.AllocFromRegion[Response](r2)
+		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+		binary.BigEndian.PutUint32(resp.buf[:4], Checksum(req.buf[:n]))
+		copy(resp.buf[4:], req.buf[:n])
+
+		if err := WriteMessage(req.conn, &resp.header, resp.buf[:4+n]); err != nil {
+			Fail("serv-hand: %v", err)
+			break
+		}
+	}
 	req.conn.Close()
+
+	deallocationStart := time.Now()
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
 }
 
 func (s *server) run(done chan bool, r1 *region.Region) {
 	r1.IncRefCounter()
 	go s.acceptConnections(done, r1)
 
-	r1.IncRefCounter()
-	go s.handleConnections(done, r1)
+	// A handler per client, so that connections are served concurrently
+	for i := 0; i < Goroutines; i++ {
+		r1.IncRefCounter()
+		go s.handleConnections(done, r1)
+	}
 }
 
 func (s *server) stop(done chan bool) error {
 	<-done // acceptConnections
-	<-done // handleConnections
-	return s.listener.Close()
+	for i := 0; i < Goroutines; i++ {
+		<-done // handleConnections
+	}
+	return s.close()
+}
+
+// close closes the listener once, Accept fails from then on.
+func (s *server) close() error {
+	s.closed.Do(func() { s.closeErr = s.listener.Close() })
+	return s.closeErr
+}
+
+// abort fails the run of a client that cannot send its requests. The server
+// would wait for connections that are never opened, so its listener is closed.
+func (s *server) abort(err error) {
+	Fail("serv-hand: %v", err)
+	s.close()
 }
 
-func sendRequests(op int, done chan bool, address string, r1 *region.Region) {
-	r2 := region.CreateRegion(op * 1064)
+// sendRequests sends op requests of ServHandPayload bytes, ServHandKeepAlive
+// on each connection to s, and checks the responses of the server.
+func sendRequests(op int, done chan bool, s *server, r1 *region.Region) {
+	r2 := region.CreateRegion(connections(op)*1072 + 1032)
+
+	allocationTimeStart := time.Now()
+	resp := region.AllocFromRegion[Response](r2)
+	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+	var req *Request
 	for i := region.AllocFromRegion[int](r2); *i < op; *i++ {
-		allocationTimeStart := time.Now()
-		req := region.AllocFromRegion[Request](r2)
-		AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+		if *i%ServHandKeepAlive == 0 {
+			if req != nil {
+				req.conn.Close()
+			}
+
+			allocationTimeStart = time.Now()
+			req = region.AllocFromRegion[Request](r2)
+			AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
+
+			var err error
+			if req.conn, err = Dial(s.listener.Addr()); err != nil {
+				s.abort(err)
+				break
+			}
+		}
 
-		req.conn, _ = net.Dial("tcp", address)
+		for j := 0; j < ServHandPayload; j++ {
+			req.buf[j] = byte(*i + j)
+		}
 
+		req.latencyStart = time.Now()
+		if err := WriteMessage(req.conn, &req.header, req.buf[:ServHandPayload]); err != nil {
+			s.abort(err)
+			break
+		}
+		n, err := ReadMessage(req.conn, &resp.header, resp.buf[:])
+		if err != nil {
+			s.abort(err)
+			break
+		}
+		Latency.Add(time.Since(req.latencyStart).Nanoseconds())
+
+		if n != 4+ServHandPayload || binary.BigEndian.Uint32(resp.buf[:4]) != Checksum(req.buf[:ServHandPayload]) {
+			Fail("serv-hand: response of %d bytes to request %d does not match its payload", n, *i)
+		}
+	}
+	if req != nil && req.conn != nil {
 		req.conn.Close()
 	}
 
@@ -114,7 +219,7 @@ func sendRequests(op int, done chan bool, address string, r1 *region.Region) {
 }
 
 func RunServerHandler() SystemMetrics {
-	debug.SetGCPercent(-1)
+	debug.SetGCPercent(GCPercent)
 
 	ComputationTime.Store(0)
 	AllocationTime.Store(0)
@@ -126,14 +231,13 @@ func RunServerHandler() SystemMetrics {
 	r1 := region.CreateRegion(0)
 
 	allocationTimeStart := time.Now()
-	address := region.AllocFromRegion[string](r1)
 	done := region.AllocChannel[bool](0, r1)
 	AllocationTime.Add(time.Since(allocationTimeStart).Nanoseconds())
-	*address = ":8080"
 
-	s, err := newServer(*address, r1)
+	s, err := newServer(ServHandNetwork, r1)
 	if err != nil {
-		fmt.Println(err)
+		Fail("serv-hand: %v", err)
+		r1.RemoveRegion()
 		return SystemMetrics{}
 	}
 
@@ -141,7 +245,7 @@ func RunServerHandler() SystemMetrics {
 
 	for i := 0; i < Goroutines; i++ {
 		if r1.IncRefCounter() {
-			go sendRequests(ServHandOp, done, *address, r1)
+			go sendRequests(ServHandOp, done, s, r1)
 		}
 	}
 
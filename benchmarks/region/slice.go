@@ -0,0 +1,62 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	"fmt"
+	"region"
+)
+
+// allocSlice returns a slice of length n whose backing array is allocated from r.
+// Regions can only allocate arrays with a length known at compile time, so the
+// backing array is rounded up to the next power of two, much like the heap
+// allocator rounds an object up to its size class.
+func allocSlice[T any](n int, r *region.Region) []T {
+	switch {
+	case n <= 1<<3:
+		return region.AllocFromRegion[[1 << 3]T](r)[:n]
+	case n <= 1<<4:
+		return region.AllocFromRegion[[1 << 4]T](r)[:n]
+	case n <= 1<<5:
+		return region.AllocFromRegion[[1 << 5]T](r)[:n]
+	case n <= 1<<6:
+		return region.AllocFromRegion[[1 << 6]T](r)[:n]
+	case n <= 1<<7:
+		return region.AllocFromRegion[[1 << 7]T](r)[:n]
+	case n <= 1<<8:
+		return region.AllocFromRegion[[1 << 8]T](r)[:n]
+	case n <= 1<<9:
+		return region.AllocFromRegion[[1 << 9]T](r)[:n]
+	case n <= 1<<10:
+		return region.AllocFromRegion[[1 << 10]T](r)[:n]
+	case n <= 1<<11:
+		return region.AllocFromRegion[[1 << 11]T](r)[:n]
+	case n <= 1<<12:
+		return region.AllocFromRegion[[1 << 12]T](r)[:n]
+	case n <= 1<<13:
+		return region.AllocFromRegion[[1 << 13]T](r)[:n]
+	case n <= 1<<14:
+		return region.AllocFromRegion[[1 << 14]T](r)[:n]
+	case n <= 1<<15:
+		return region.AllocFromRegion[[1 << 15]T](r)[:n]
+	case n <= 1<<16:
+		return region.AllocFromRegion[[1 << 16]T](r)[:n]
+	case n <= 1<<17:
+		return region.AllocFromRegion[[1 << 17]T](r)[:n]
+	case n <= 1<<18:
+		return region.AllocFromRegion[[1 << 18]T](r)[:n]
+	case n <= 1<<19:
+		return region.AllocFromRegion[[1 << 19]T](r)[:n]
+	case n <= 1<<20:
+		return region.AllocFromRegion[[1 << 20]T](r)[:n]
+	case n <= 1<<21:
+		return region.AllocFromRegion[[1 << 21]T](r)[:n]
+	case n <= 1<<22:
+		return region.AllocFromRegion[[1 << 22]T](r)[:n]
+	case n <= 1<<23:
+		return region.AllocFromRegion[[1 << 23]T](r)[:n]
+	case n <= 1<<24:
+		return region.AllocFromRegion[[1 << 24]T](r)[:n]
+	}
+	panic(fmt.Sprintf("allocSlice: %d elements exceeds the largest size class", n))
+}
@@ -0,0 +1,193 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"math/rand/v2"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+var (
+	logLevels = []string{"debug", "info", "warn", "error"}
+	logWords  = []string{"request", "served", "user", "cache", "miss", "retry", "connection", "closed", "timeout", "ok", "session", "expired"}
+)
+
+// A byteBuffer doubles its capacity when it runs out of room. Its backing arrays
+// are allocated from its region, so the ones it outgrew stay there until the
+// region is removed.
+type byteBuffer struct {
+	buf []byte
+	r   *region.Region
+}
+
+func (b *byteBuffer) grow(n int) {
+	if len(b.buf)+n <= cap(b.buf) {
+		return
+	}
+	allocationStart := time.Now()
+	buf := allocSlice[byte](max(2*cap(b.buf), len(b.buf)+n, 16), b.r)[:len(b.buf)]
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	copy(buf, b.buf)
+	b.buf = buf
+}
+
+func (b *byteBuffer) write(p []byte) {
+	b.grow(len(p))
+	b.buf = append(b.buf, p...)
+}
+
+func (b *byteBuffer) writeString(s string) {
+	b.grow(len(s))
+	b.buf = append(b.buf, s...)
+}
+
+func (b *byteBuffer) writeInt(x int) {
+	b.grow(20)
+	b.buf = strconv.AppendInt(b.buf, int64(x), 10)
+}
+
+// renderLine formats a log line of up to StringFields key=value fields into a
+// new buffer allocated from r.
+func renderLine(n int, rng *rand.Rand, r *region.Region) *byteBuffer {
+	allocationStart := time.Now()
+	line := region.AllocFromRegion[byteBuffer](r)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	line.r = r
+	line.writeString("ts=")
+	line.writeInt(n)
+	line.writeString(" level=")
+	line.writeString(logLevels[rng.IntN(len(logLevels))])
+	line.writeString(" msg=\"")
+	for w := rng.IntN(8); w >= 0; w-- {
+		line.writeString(logWords[rng.IntN(len(logWords))])
+		if w > 0 {
+			line.writeString(" ")
+		}
+	}
+	line.writeString("\"")
+	for f := 1 + rng.IntN(StringFields); f > 0; f-- {
+		line.writeString(" ")
+		line.writeString(logWords[rng.IntN(len(logWords))])
+		line.writeString("=")
+		line.writeInt(rng.IntN(1 << 20))
+	}
+	line.writeString("\n")
+	return line
+}
+
+// checkLog fails the run unless log holds lines lines of length bytes in total.
+func checkLog(log *byteBuffer, lines int, length int) {
+	newlines := 0
+	for _, c := range log.buf {
+		if c == '\n' {
+			newlines++
+		}
+	}
+	if newlines != lines || len(log.buf) != length {
+		Fail("string-builder: log has %d lines of %d bytes, expected %d lines of %d", newlines, len(log.buf), lines, length)
+	}
+}
+
+func generateLogLines(id int, done chan bool, r1 *region.Region) {
+	r2 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	i := region.AllocFromRegion[int](r2)
+	pcg := region.AllocFromRegion[rand.PCG](r2)
+	rng := region.AllocFromRegion[rand.Rand](r2)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	pcg.Seed(Seed, uint64(id))
+	*rng = *rand.New(pcg)
+
+	// The log and the lines written to it live in r3 until the log is flushed
+	var r3 *region.Region
+	var log *byteBuffer
+	lines, length := 0, 0
+	for *i = 0; *i < StringOp; *i++ {
+		// Flushing the log removes its region
+		if *i%StringFlush == 0 {
+			if r3 != nil {
+				deallocationStart := time.Now()
+				r3.RemoveRegion()
+				DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+			}
+			r3 = region.CreateRegion(0)
+
+			allocationStart = time.Now()
+			log = region.AllocFromRegion[byteBuffer](r3)
+			AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+			log.r = r3
+			lines, length = 0, 0
+		}
+
+		latencyStart := time.Now()
+		line := renderLine(*i, rng, r3)
+		log.write(line.buf)
+		Latency.Add(time.Since(latencyStart).Nanoseconds())
+
+		lines++
+		length += len(line.buf)
+		if Verify && ((*i+1)%StringFlush == 0 || *i+1 == StringOp) {
+			checkLog(log, lines, length)
+		}
+	}
+
+	deallocationStart := time.Now()
+	if r3 != nil {
+		r3.RemoveRegion()
+	}
+	r2.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	r1.DecRefCounter()
+	done <- true
+}
+
+func RunStringBuilder() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	done := region.AllocChannel[bool](0, r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	for i := 0; i < Goroutines; i++ {
+		if r1.IncRefCounter() {
+			go generateLogLines(i, done, r1)
+		}
+	}
+
+	for i := 0; i < Goroutines; i++ {
+		<-done
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(StringOp*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
@@ -0,0 +1,132 @@
+//go:build goexperiment.regions
+
+package region
+
+import (
+	. "experiments/benchmarks/metrics"
+	"region"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// A job is fanned out by the dispatcher to one of the workers.
+type job struct {
+	id           int
+	latencyStart time.Time
+}
+
+// A jobResult is fanned back in from the workers to the merger.
+type jobResult struct {
+	sum          int
+	latencyStart time.Time
+}
+
+// dispatch fans WorkerPoolJobs jobs per worker out to the pool.
+func dispatch(jobs chan job, r1 *region.Region) {
+	for i := region.AllocFromRegion[int](r1); *i < WorkerPoolJobs*Goroutines; *i++ {
+		jobs <- job{id: *i, latencyStart: time.Now()}
+	}
+	close(jobs)
+	r1.DecRefCounter()
+}
+
+// work runs the jobs it receives, every job fills and sums its own scratch slice,
+// which lives in a region that is removed as soon as the job is done.
+func work(jobs chan job, results chan jobResult, done chan bool, r1 *region.Region) {
+	for j := range jobs {
+		r2 := region.CreateRegion(0)
+
+		allocationStart := time.Now()
+		scratch := allocSlice[int](WorkerPoolScratch, r2)
+		sum := region.AllocFromRegion[int](r2)
+		AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+		for k := range scratch {
+			scratch[k] = j.id + k
+		}
+		for _, x := range scratch {
+			*sum += x
+		}
+		results <- jobResult{sum: *sum, latencyStart: j.latencyStart}
+
+		deallocationStart := time.Now()
+		r2.RemoveRegion()
+		DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+	}
+	r1.DecRefCounter()
+	done <- true
+}
+
+// merge fans the results of the workers in and sums them.
+func merge(results chan jobResult, done chan bool, total *int, r1 *region.Region) {
+	for res := range results {
+		*total += res.sum
+		Latency.Add(time.Since(res.latencyStart).Nanoseconds())
+	}
+	r1.DecRefCounter()
+	done <- true
+}
+
+// expectedTotal is the sum of the results of all jobs.
+func expectedTotal() int {
+	jobs, n := WorkerPoolJobs*Goroutines, WorkerPoolScratch
+	return n*jobs*(jobs-1)/2 + jobs*n*(n-1)/2
+}
+
+func RunWorkerPool() SystemMetrics {
+	debug.SetGCPercent(GCPercent)
+
+	ComputationTime.Store(0)
+	AllocationTime.Store(0)
+	DeallocationTime.Store(0)
+	Latency.Store(0)
+
+	computationTimeStart := time.Now()
+	r1 := region.CreateRegion(0)
+
+	allocationStart := time.Now()
+	jobs := region.AllocChannel[job](Goroutines, r1)
+	results := region.AllocChannel[jobResult](Goroutines, r1)
+	doneWorkers := region.AllocChannel[bool](0, r1)
+	doneMerge := region.AllocChannel[bool](0, r1)
+	total := region.AllocFromRegion[int](r1)
+	AllocationTime.Add(time.Since(allocationStart).Nanoseconds())
+
+	if r1.IncRefCounter() {
+		go dispatch(jobs, r1)
+	}
+	for w := 0; w < Goroutines; w++ {
+		if r1.IncRefCounter() {
+			go work(jobs, results, doneWorkers, r1)
+		}
+	}
+	if r1.IncRefCounter() {
+		go merge(results, doneMerge, total, r1)
+	}
+
+	for w := 0; w < Goroutines; w++ {
+		<-doneWorkers
+	}
+	close(results)
+	<-doneMerge
+
+	if Verify && *total != expectedTotal() {
+		Fail("worker-pool: merged %d, expected %d", *total, expectedTotal())
+	}
+
+	deallocationStart := time.Now()
+	r1.RemoveRegion()
+	DeallocationTime.Add(time.Since(deallocationStart).Nanoseconds())
+
+	ComputationTime.Store(time.Since(computationTimeStart).Nanoseconds())
+
+	runtime.GC()
+
+	return SystemMetrics{
+		float64(ComputationTime.Load()),
+		float64(WorkerPoolJobs*Goroutines) / float64(ComputationTime.Load()),
+		float64(Latency.Load()),
+		float64(AllocationTime.Load()),
+		float64(DeallocationTime.Load())}
+}
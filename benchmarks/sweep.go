@@ -0,0 +1,248 @@
+//go:build goexperiment.regions
+
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A configuration is a single program run with a memory manager and an amount of goroutines.
+type configuration struct {
+	Program    string
+	MM         MemoryManager
+	Goroutines int
+}
+
+func (c configuration) String() string {
+	return fmt.Sprintf("%s %s G=%d", c.Program, c.MM, c.Goroutines)
+}
+
+// path returns the path of the per-configuration results file with the given suffix,
+// e.g. results/bin-tree/16-GC-sys.csv.
+func (c configuration) path(suffix string) string {
+	return filepath.Join(exp.Results, c.Program, strconv.Itoa(c.Goroutines)+"-"+c.MM.String()+"-"+suffix)
+}
+
+// summaryPath returns the path of the file holding one averaged row per amount of goroutines.
+func (c configuration) summaryPath() string {
+	return filepath.Join(exp.Results, c.Program, c.MM.String()+"-sys.csv")
+}
+
+// programNames lists the programs runTests knows by name. alloc-sweep,
+// channel-matrix and region-lifecycle are expanded by newSweep into the
+// programs they stand for.
+var programNames = []string{
+	"mat-mul", "bin-tree", "avl-tree", "pro-con", "serv-hand", "http", "pipeline", "worker-pool",
+	"lru-cache", "graph", "json", "string-builder", "nested-regions", "hash-map", "hash-map-resize",
+	"alloc", "channel", "alloc-sweep", "channel-matrix", "region-lifecycle",
+}
+
+// newSweep returns every combination of the programs, memory managers and goroutine counts
+// of an experiment, ordered by program, then memory manager, then goroutines.
+func newSweep(e experiment) []configuration {
+	var configs []configuration
+	for _, p := range e.Programs {
+		programs := []string{strings.TrimSpace(p)}
+		switch programs[0] {
+		case "alloc-sweep":
+			programs = allocSweepPrograms(e.Workload.AllocSweepSizes)
+		case "channel-matrix":
+			programs = channelMatrixPrograms(e.Workload.ChannelBuffers, e.Workload.ChannelPayloads, e.Workload.ChannelRatios)
+		case "region-lifecycle":
+			programs = lifecyclePrograms(e.Workload.LifecycleSizes, e.Workload.LifecycleObjects, e.Workload.LifecycleDepths)
+		}
+		for _, p := range programs {
+			for _, mm := range e.Managers {
+				for _, g := range e.Goroutines {
+					configs = append(configs, configuration{p, mm, g})
+				}
+			}
+		}
+	}
+	return configs
+}
+
+// allocSweepPrograms expands the alloc-sweep program into a program per object
+// size, allocating objects made of bytes and objects made of pointers, e.g.
+// alloc-sweep/4096-bytes and alloc-sweep/4096-pointers. Each has its own results.
+func allocSweepPrograms(sizes []int) []string {
+	var programs []string
+	for _, size := range sizes {
+		programs = append(programs, fmt.Sprintf("alloc-sweep/%d-bytes", size), fmt.Sprintf("alloc-sweep/%d-pointers", size))
+	}
+	return programs
+}
+
+// parseAllocSweep returns the object size of a program of allocSweepPrograms
+// and whether its objects are made of pointers.
+func parseAllocSweep(program string) (int, bool, bool) {
+	rest, ok := strings.CutPrefix(program, "alloc-sweep/")
+	if !ok {
+		return 0, false, false
+	}
+	s, kind, _ := strings.Cut(rest, "-")
+	size, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, false
+	}
+	switch kind {
+	case "bytes":
+		return size, false, true
+	case "pointers":
+		return size, true, true
+	}
+	return 0, false, false
+}
+
+// validSweepSize reports whether alloc-sweep has objects of size bytes.
+func validSweepSize(size int) bool {
+	return size >= 8 && size <= 1<<24 && size&(size-1) == 0
+}
+
+// channelMatrixPrograms expands the channel-matrix program into a program per
+// combination of channel buffer, payload size and ratio of senders to receivers,
+// e.g. channel-matrix/buf64-pay256-1x4. Each has its own results.
+func channelMatrixPrograms(buffers []int, payloads []int, ratios []string) []string {
+	var programs []string
+	for _, b := range buffers {
+		for _, p := range payloads {
+			for _, r := range ratios {
+				programs = append(programs, fmt.Sprintf("channel-matrix/buf%d-pay%d-%s", b, p, r))
+			}
+		}
+	}
+	return programs
+}
+
+// parseChannelMatrix returns the buffer, payload size, senders and receivers
+// of a program of channelMatrixPrograms.
+func parseChannelMatrix(program string) (int, int, int, int, bool) {
+	var buffer, payload, senders, receivers int
+	n, err := fmt.Sscanf(program, "channel-matrix/buf%d-pay%d-%dx%d", &buffer, &payload, &senders, &receivers)
+	if n != 4 || err != nil || buffer < 0 || senders < 1 || receivers < 1 {
+		return 0, 0, 0, 0, false
+	}
+	if payload < 8 || payload > 1<<15 || payload&(payload-1) != 0 {
+		return 0, 0, 0, 0, false
+	}
+	return buffer, payload, senders, receivers, true
+}
+
+// lifecyclePrograms expands the region-lifecycle program into a program per
+// combination of initial region size, objects per region and nesting depth,
+// e.g. region-lifecycle/size4096-obj100-depth4. Each has its own results.
+func lifecyclePrograms(sizes []int, objects []int, depths []int) []string {
+	var programs []string
+	for _, s := range sizes {
+		for _, o := range objects {
+			for _, d := range depths {
+				programs = append(programs, fmt.Sprintf("region-lifecycle/size%d-obj%d-depth%d", s, o, d))
+			}
+		}
+	}
+	return programs
+}
+
+// parseLifecycle returns the initial region size, objects and depth of a
+// program of lifecyclePrograms.
+func parseLifecycle(program string) (int, int, int, bool) {
+	var size, objects, depth int
+	n, err := fmt.Sscanf(program, "region-lifecycle/size%d-obj%d-depth%d", &size, &objects, &depth)
+	if n != 3 || err != nil || size < 0 || objects < 0 || depth < 1 {
+		return 0, 0, 0, false
+	}
+	return size, objects, depth, true
+}
+
+func parseMemoryManager(s string) (MemoryManager, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "GC":
+		return GC, nil
+	case "RBMM":
+		return RBMM, nil
+	}
+	return 0, fmt.Errorf("unknown memory manager %q", s)
+}
+
+func (mm MemoryManager) MarshalText() ([]byte, error) {
+	return []byte(mm.String()), nil
+}
+
+func (mm *MemoryManager) UnmarshalText(b []byte) error {
+	var err error
+	*mm, err = parseMemoryManager(string(b))
+	return err
+}
+
+// parseGoroutines parses either a comma-separated list of goroutine counts (1,16,32)
+// or a geometric range start:end:factor, where 1:256:2 is 1, 2, 4, ..., 256.
+func parseGoroutines(s string) ([]int, error) {
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("goroutine range %q is not start:end:factor", s)
+		}
+		var bounds [3]int
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("goroutine range %q: %v", s, err)
+			}
+			bounds[i] = n
+		}
+		start, end, factor := bounds[0], bounds[1], bounds[2]
+		if start < 1 || end < start || factor < 2 {
+			return nil, fmt.Errorf("goroutine range %q needs 1 <= start <= end and factor >= 2", s)
+		}
+		var gs []int
+		for g := start; g <= end; g *= factor {
+			gs = append(gs, g)
+		}
+		return gs, nil
+	}
+
+	var gs []int
+	for _, p := range strings.Split(s, ",") {
+		g, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("goroutine count %q: %v", p, err)
+		}
+		if g < 1 {
+			return nil, fmt.Errorf("goroutine count %d must be positive", g)
+		}
+		gs = append(gs, g)
+	}
+	return gs, nil
+}
+
+// shuffleSweep randomizes the order of the configurations so that drift over
+// the time of a sweep (thermal throttling, background load) is spread over all
+// of them instead of biasing the last ones.
+func shuffleSweep(configs []configuration, seed uint64) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	rng.Shuffle(len(configs), func(i, j int) {
+		configs[i], configs[j] = configs[j], configs[i]
+	})
+}
+
+// prepareResults creates the result directories of the sweep and, unless
+// appending, removes the summaries it is about to write so they only hold rows of this sweep.
+func prepareResults(configs []configuration, appending bool) error {
+	for _, c := range configs {
+		if err := os.MkdirAll(filepath.Dir(c.summaryPath()), 0755); err != nil {
+			return err
+		}
+		if appending {
+			continue
+		}
+		if err := os.Remove(c.summaryPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//go:build goexperiment.regions
+
+package main
+
+import (
+	"encoding/csv"
+	. "experiments/benchmarks/metrics"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A failure is a run that did not complete or produced a wrong result.
+type failure struct {
+	// Measured round that failed, -1 for a warm-up run
+	Round  int
+	Reason string
+	// Stacks of all goroutines when the run hung
+	Stacks string
+}
+
+// hung reports whether a run of r did not complete.
+func (r result) hung() bool {
+	for _, f := range r.Failures {
+		if f.Stacks != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// runWithWatchdog runs a workload and gives up on it if it has not finished
+// before the deadline of the experiment. The goroutines of a hung workload
+// cannot be stopped, so after a failure the process must not measure anything
+// else. validate therefore only allows a deadline with -isolate, where measure
+// stops at the first hang and the child process exits.
+func runWithWatchdog(c configuration) (SystemMetrics, *failure) {
+	if exp.Deadline <= 0 {
+		return runTests(c.Program, c.MM), nil
+	}
+
+	metrics := make(chan SystemMetrics, 1)
+	go func() {
+		metrics <- runTests(c.Program, c.MM)
+	}()
+
+	timer := time.NewTimer(time.Duration(exp.Deadline))
+	defer timer.Stop()
+	select {
+	case m := <-metrics:
+		return m, nil
+	case <-timer.C:
+		return SystemMetrics{}, &failure{
+			Reason: fmt.Sprintf("run did not finish within %v", time.Duration(exp.Deadline)),
+			Stacks: allStacks(),
+		}
+	}
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until they fit.
+func allStacks() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// writeFailures records the failed runs of a configuration in <G>-<MM>-failures.csv
+// and the goroutine stacks of each failure in <G>-<MM>-stacks.txt.
+func writeFailures(failures []failure, c configuration) {
+	output := [][]string{{"Round", "Reason"}}
+	var stacks strings.Builder
+	for _, f := range failures {
+		output = append(output, []string{strconv.Itoa(f.Round), f.Reason})
+		fmt.Fprintf(&stacks, "round %d: %s\n\n%s\n", f.Round, f.Reason, f.Stacks)
+	}
+
+	file, _ := os.OpenFile(c.path("failures.csv"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	csvWriter := csv.NewWriter(file)
+	csvWriter.WriteAll(output)
+	file.Close()
+
+	os.WriteFile(c.path("stacks.txt"), []byte(stacks.String()), 0600)
+
+	fmt.Fprintf(os.Stderr, "%s: %d run(s) failed, see %s\n", c, len(failures), c.path("failures.csv"))
+}